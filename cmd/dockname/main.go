@@ -2,20 +2,33 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/kiwamizamurai/dockname/internal/config"
 	"github.com/kiwamizamurai/dockname/internal/container"
 	"github.com/kiwamizamurai/dockname/internal/proxy"
 	"github.com/rs/zerolog"
 )
 
 func main() {
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	consoleWriter := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
 	logger := zerolog.New(consoleWriter).With().Timestamp().Logger()
-	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	zerolog.SetGlobalLevel(cfg.Level())
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -25,7 +38,7 @@ func main() {
 		logger.Fatal().Err(err).Msg("Failed to create Docker manager")
 	}
 
-	proxyManager := proxy.NewManager(dockerManager, nil, logger)
+	proxyManager := proxy.NewManager(dockerManager, &cfg.Config, logger)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
@@ -39,4 +52,5 @@ func main() {
 	if err := proxyManager.Start(ctx); err != nil {
 		logger.Fatal().Err(err).Msg("Failed to start proxy manager")
 	}
+	logger.Info().Msg("Shutdown complete")
 }
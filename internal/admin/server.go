@@ -0,0 +1,248 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/kiwamizamurai/dockname/internal/proxy/handler"
+	"github.com/rs/zerolog"
+)
+
+type RouteStore interface {
+	GetRoutes() []handler.Route
+	AddUpstream(route handler.Route, upstream *handler.Upstream) error
+	SetRouteDisabled(host, path string, disabled bool) bool
+	RemoveRoute(host, path string) bool
+}
+
+type Server struct {
+	store  RouteStore
+	mux    *http.ServeMux
+	logger zerolog.Logger
+}
+
+type upstreamResponse struct {
+	ID             string            `json:"id"`
+	ContainerName  string            `json:"container_name,omitempty"`
+	Target         string            `json:"target"`
+	Protocol       string            `json:"protocol"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	RegisteredAt   time.Time         `json:"registered_at"`
+	ActiveRequests int64             `json:"active_requests"`
+	Health         string            `json:"health"`
+	HealthCheck    string            `json:"health_check,omitempty"`
+	Circuit        string            `json:"circuit"`
+	Available      bool              `json:"available"`
+}
+
+type routeResponse struct {
+	Host          string             `json:"host"`
+	Path          string             `json:"path"`
+	StripPrefix   bool               `json:"strip_prefix"`
+	RedirectHTTPS bool               `json:"redirect_https"`
+	LoadBalancer  string             `json:"load_balancer,omitempty"`
+	Disabled      bool               `json:"disabled"`
+	MaxUpgrades   int                `json:"max_upgrades,omitempty"`
+	Upgrades      int64              `json:"upgrades"`
+	Upstreams     []upstreamResponse `json:"upstreams"`
+}
+
+type addRouteRequest struct {
+	Host          string `json:"host"`
+	Path          string `json:"path"`
+	Target        string `json:"target"`
+	StripPrefix   bool   `json:"strip_prefix"`
+	RedirectHTTPS bool   `json:"redirect_https"`
+	LoadBalancer  string `json:"load_balancer"`
+}
+
+type updateRouteRequest struct {
+	Host     string `json:"host"`
+	Path     string `json:"path"`
+	Disabled bool   `json:"disabled"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewServer(store RouteStore, logger zerolog.Logger) *Server {
+	s := &Server{
+		store:  store,
+		mux:    http.NewServeMux(),
+		logger: logger,
+	}
+	s.mux.HandleFunc("/api/routes", s.handleRoutes)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleRoutes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listRoutes(w)
+	case http.MethodPost:
+		s.addRoute(w, r)
+	case http.MethodPatch:
+		s.updateRoute(w, r)
+	case http.MethodDelete:
+		s.removeRoute(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, PATCH, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *Server) listRoutes(w http.ResponseWriter) {
+	routes := s.store.GetRoutes()
+	response := make([]routeResponse, 0, len(routes))
+	for _, route := range routes {
+		response = append(response, newRouteResponse(route))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) addRoute(w http.ResponseWriter, r *http.Request) {
+	var req addRouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.Host == "" || req.Target == "" {
+		writeError(w, http.StatusBadRequest, errors.New("host and target are required"))
+		return
+	}
+
+	target, err := url.Parse(req.Target)
+	if err != nil || target.Host == "" || (target.Scheme != "http" && target.Scheme != "https") {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid target URL: %s", req.Target))
+		return
+	}
+
+	route := handler.Route{
+		Host:          req.Host,
+		Path:          handler.NormalizePath(req.Path),
+		StripPrefix:   req.StripPrefix,
+		RedirectHTTPS: req.RedirectHTTPS,
+		LoadBalancer:  req.LoadBalancer,
+	}
+	upstream := handler.NewUpstream("manual:"+target.String(), target)
+	if err := s.store.AddUpstream(route, upstream); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.logger.Info().
+		Str("domain", route.Host).
+		Str("path", route.Path).
+		Str("target", target.String()).
+		Msg("Added route via admin API")
+
+	for _, added := range s.store.GetRoutes() {
+		if added.Host == route.Host && added.Path == route.Path {
+			writeJSON(w, http.StatusCreated, newRouteResponse(added))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) updateRoute(w http.ResponseWriter, r *http.Request) {
+	var req updateRouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.Host == "" {
+		writeError(w, http.StatusBadRequest, errors.New("host is required"))
+		return
+	}
+
+	if !s.store.SetRouteDisabled(req.Host, req.Path, req.Disabled) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("route not found: %s%s", req.Host, handler.NormalizePath(req.Path)))
+		return
+	}
+
+	s.logger.Info().
+		Str("domain", req.Host).
+		Str("path", handler.NormalizePath(req.Path)).
+		Bool("disabled", req.Disabled).
+		Msg("Updated route via admin API")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) removeRoute(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	path := r.URL.Query().Get("path")
+	if host == "" {
+		writeError(w, http.StatusBadRequest, errors.New("host is required"))
+		return
+	}
+
+	if !s.store.RemoveRoute(host, path) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("route not found: %s%s", host, handler.NormalizePath(path)))
+		return
+	}
+
+	s.logger.Info().
+		Str("domain", host).
+		Str("path", handler.NormalizePath(path)).
+		Msg("Removed route via admin API")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newRouteResponse(route handler.Route) routeResponse {
+	response := routeResponse{
+		Host:          route.Host,
+		Path:          route.Path,
+		StripPrefix:   route.StripPrefix,
+		RedirectHTTPS: route.RedirectHTTPS,
+		LoadBalancer:  route.LoadBalancer,
+		Disabled:      route.Disabled,
+		MaxUpgrades:   route.MaxUpgrades,
+		Upgrades:      route.ActiveUpgrades(),
+		Upstreams:     make([]upstreamResponse, 0, len(route.Upstreams)),
+	}
+	for _, upstream := range route.Upstreams {
+		response.Upstreams = append(response.Upstreams, upstreamResponse{
+			ID:             upstream.ID,
+			ContainerName:  upstream.ContainerName,
+			Target:         upstream.Target.String(),
+			Protocol:       string(upstream.Protocol()),
+			Labels:         upstream.Labels,
+			RegisteredAt:   upstream.RegisteredAt,
+			ActiveRequests: upstream.ActiveRequests(),
+			Health:         upstream.Health().String(),
+			HealthCheck:    healthCheckStatus(upstream),
+			Circuit:        upstream.CircuitState().String(),
+			Available:      upstream.Available(),
+		})
+	}
+	return response
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// healthCheckStatus returns the result of dockname's own health check of the
+// upstream, or an empty string when it is not checked.
+func healthCheckStatus(upstream *handler.Upstream) string {
+	if status := upstream.CheckStatus(); status != handler.HealthNone {
+		return status.String()
+	}
+	return ""
+}
@@ -0,0 +1,177 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kiwamizamurai/dockname/internal/proxy/handler"
+	"github.com/rs/zerolog"
+)
+
+func newTestStore(t *testing.T) *handler.ProxyHandler {
+	t.Helper()
+	store := handler.NewProxyHandler(zerolog.Nop())
+
+	target, err := url.Parse("http://172.17.0.2:8080")
+	if err != nil {
+		t.Fatalf("Failed to parse target URL: %v", err)
+	}
+	upstream := handler.NewUpstream("container1", target)
+	upstream.ContainerName = "web"
+	upstream.Labels = map[string]string{"dockname.domain": "web.localhost"}
+
+	if err := store.AddUpstream(handler.Route{Host: "web.localhost"}, upstream); err != nil {
+		t.Fatalf("AddUpstream() error = %v", err)
+	}
+	return store
+}
+
+func TestServer_ListRoutes(t *testing.T) {
+	server := NewServer(newTestStore(t), zerolog.Nop())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/routes", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/routes status code = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var routes []routeResponse
+	if err := json.NewDecoder(w.Body).Decode(&routes); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(routes) != 1 || len(routes[0].Upstreams) != 1 {
+		t.Fatalf("GET /api/routes = %+v, want a single route with one upstream", routes)
+	}
+
+	route := routes[0]
+	upstream := route.Upstreams[0]
+	if route.Host != "web.localhost" || route.Path != "/" {
+		t.Errorf("route = %s%s, want web.localhost/", route.Host, route.Path)
+	}
+	if upstream.ID != "container1" || upstream.ContainerName != "web" {
+		t.Errorf("upstream = %s (%s), want container1 (web)", upstream.ID, upstream.ContainerName)
+	}
+	if upstream.Target != "http://172.17.0.2:8080" {
+		t.Errorf("upstream target = %v, want http://172.17.0.2:8080", upstream.Target)
+	}
+	if upstream.Labels["dockname.domain"] != "web.localhost" {
+		t.Errorf("upstream labels = %v, want dockname.domain label", upstream.Labels)
+	}
+	if upstream.RegisteredAt.IsZero() {
+		t.Error("upstream registered_at is not set")
+	}
+}
+
+func TestServer_ManageRoutes(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		wantStatusCode int
+		wantRoutes     int
+		wantDisabled   bool
+	}{
+		{
+			name:           "Success: Add route",
+			method:         http.MethodPost,
+			target:         "/api/routes",
+			body:           `{"host": "api.localhost", "path": "/v1", "target": "http://172.17.0.3:3000"}`,
+			wantStatusCode: http.StatusCreated,
+			wantRoutes:     2,
+		},
+		{
+			name:           "Error: Add route without target",
+			method:         http.MethodPost,
+			target:         "/api/routes",
+			body:           `{"host": "api.localhost"}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantRoutes:     1,
+		},
+		{
+			name:           "Error: Add route with invalid target",
+			method:         http.MethodPost,
+			target:         "/api/routes",
+			body:           `{"host": "api.localhost", "target": "172.17.0.3:3000"}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantRoutes:     1,
+		},
+		{
+			name:           "Error: Add route with unknown load balancer",
+			method:         http.MethodPost,
+			target:         "/api/routes",
+			body:           `{"host": "api.localhost", "target": "http://172.17.0.3:3000", "load_balancer": "random"}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantRoutes:     1,
+		},
+		{
+			name:           "Success: Disable route",
+			method:         http.MethodPatch,
+			target:         "/api/routes",
+			body:           `{"host": "web.localhost", "path": "/", "disabled": true}`,
+			wantStatusCode: http.StatusNoContent,
+			wantRoutes:     1,
+			wantDisabled:   true,
+		},
+		{
+			name:           "Error: Disable unknown route",
+			method:         http.MethodPatch,
+			target:         "/api/routes",
+			body:           `{"host": "unknown.localhost", "disabled": true}`,
+			wantStatusCode: http.StatusNotFound,
+			wantRoutes:     1,
+		},
+		{
+			name:           "Success: Remove route",
+			method:         http.MethodDelete,
+			target:         "/api/routes?host=web.localhost&path=/",
+			wantStatusCode: http.StatusNoContent,
+			wantRoutes:     0,
+		},
+		{
+			name:           "Error: Remove unknown route",
+			method:         http.MethodDelete,
+			target:         "/api/routes?host=unknown.localhost",
+			wantStatusCode: http.StatusNotFound,
+			wantRoutes:     1,
+		},
+		{
+			name:           "Error: Unsupported method",
+			method:         http.MethodPut,
+			target:         "/api/routes",
+			wantStatusCode: http.StatusMethodNotAllowed,
+			wantRoutes:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t)
+			server := NewServer(store, zerolog.Nop())
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatusCode {
+				t.Errorf("%s %s status code = %v, want %v (body: %s)", tt.method, tt.target, w.Code, tt.wantStatusCode, w.Body.String())
+			}
+
+			routes := store.GetRoutes()
+			if len(routes) != tt.wantRoutes {
+				t.Errorf("GetRoutes() = %d routes, want %d", len(routes), tt.wantRoutes)
+			}
+			for _, route := range routes {
+				if route.Host == "web.localhost" && route.Disabled != tt.wantDisabled {
+					t.Errorf("web.localhost disabled = %v, want %v", route.Disabled, tt.wantDisabled)
+				}
+			}
+		})
+	}
+}
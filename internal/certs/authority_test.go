@@ -0,0 +1,118 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestNewAuthority(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+
+	authority, err := NewAuthority(dir, nil, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewAuthority() error = %v", err)
+	}
+	if !authority.Certificate().IsCA {
+		t.Error("NewAuthority() certificate is not a CA")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, caKeyFile))
+	if err != nil {
+		t.Fatalf("CA key was not persisted: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("CA key permissions = %v, want 0600", info.Mode().Perm())
+	}
+
+	reloaded, err := NewAuthority(dir, nil, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewAuthority() reload error = %v", err)
+	}
+	if !reloaded.Certificate().Equal(authority.Certificate()) {
+		t.Error("NewAuthority() generated a new CA instead of loading the persisted one")
+	}
+}
+
+func TestNewAuthority_InvalidCertificate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, caCertFile), []byte("invalid"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, caKeyFile), []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewAuthority(dir, nil, zerolog.Nop()); err == nil {
+		t.Error("NewAuthority() error = nil, want error for corrupt CA files")
+	}
+}
+
+func TestAuthority_GetCertificate(t *testing.T) {
+	policy := func(host string) bool {
+		return host == "app.localhost"
+	}
+	authority, err := NewAuthority(t.TempDir(), policy, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewAuthority() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		serverName string
+		wantErr    bool
+	}{
+		{
+			name:       "Success: Certificate for routed host",
+			serverName: "app.localhost",
+			wantErr:    false,
+		},
+		{
+			name:       "Success: Server name is normalized",
+			serverName: "APP.localhost.",
+			wantErr:    false,
+		},
+		{
+			name:       "Error: Host without route",
+			serverName: "unknown.localhost",
+			wantErr:    true,
+		},
+		{
+			name:       "Error: Missing server name",
+			serverName: "",
+			wantErr:    true,
+		},
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.Certificate())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := authority.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if _, err := cert.Leaf.Verify(x509.VerifyOptions{
+				DNSName: "app.localhost",
+				Roots:   roots,
+			}); err != nil {
+				t.Errorf("GetCertificate() certificate does not verify: %v", err)
+			}
+		})
+	}
+
+	first, _ := authority.GetCertificate(&tls.ClientHelloInfo{ServerName: "app.localhost"})
+	second, _ := authority.GetCertificate(&tls.ClientHelloInfo{ServerName: "app.localhost"})
+	if first != second {
+		t.Error("GetCertificate() did not reuse the cached certificate")
+	}
+}
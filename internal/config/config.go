@@ -0,0 +1,348 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kiwamizamurai/dockname/internal/proxy"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "DOCKNAME_"
+
+type Config struct {
+	proxy.Config `yaml:",inline"`
+	LogLevel     string `yaml:"log_level"`
+}
+
+func Default() *Config {
+	return &Config{
+		Config:   *proxy.DefaultConfig(),
+		LogLevel: "info",
+	}
+}
+
+// setting describes an option that can be set from the command line and the
+// environment. The flag name maps to the environment variable by upper-casing
+// it, replacing dashes with underscores and adding the DOCKNAME_ prefix.
+type setting struct {
+	name  string
+	usage string
+	get   func(c *Config) string
+	apply func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{
+		name:  "port",
+		usage: "`address` of the HTTP listener",
+		get:   func(c *Config) string { return c.Port },
+		apply: func(c *Config, v string) error { c.Port = v; return nil },
+	},
+	{
+		name:  "https-port",
+		usage: "`address` of the HTTPS listener, empty to disable",
+		get:   func(c *Config) string { return c.HTTPSPort },
+		apply: func(c *Config, v string) error { c.HTTPSPort = v; return nil },
+	},
+	{
+		name:  "cert-dir",
+		usage: "`directory` holding the development CA",
+		get:   func(c *Config) string { return c.CertDir },
+		apply: func(c *Config, v string) error { c.CertDir = v; return nil },
+	},
+	{
+		name:  "admin-port",
+		usage: "`address` of the unauthenticated admin API listener, e.g. 127.0.0.1:8081; empty to disable",
+		get:   func(c *Config) string { return c.AdminPort },
+		apply: func(c *Config, v string) error { c.AdminPort = v; return nil },
+	},
+	{
+		name:  "tcp-port",
+		usage: "`address` of the TCP listener routing TLS connections by server name, empty to disable",
+		get:   func(c *Config) string { return c.TCPPort },
+		apply: func(c *Config, v string) error { c.TCPPort = v; return nil },
+	},
+	{
+		name:  "shutdown-timeout",
+		usage: "maximum `duration` to wait for in-flight requests on shutdown",
+		get:   func(c *Config) string { return c.ShutdownTimeout.String() },
+		apply: func(c *Config, v string) error { return parseDuration(&c.ShutdownTimeout, v) },
+	},
+	{
+		name:  "network",
+		usage: "`name` of the network preferred to reach containers on",
+		get:   func(c *Config) string { return c.Network },
+		apply: func(c *Config, v string) error { c.Network = v; return nil },
+	},
+	{
+		name:  "domain-template",
+		usage: "`template` generating the domain of unlabeled containers, e.g. {{.ComposeService}}.{{.ComposeProject}}.localhost; empty to disable",
+		get:   func(c *Config) string { return c.DomainTemplate },
+		apply: func(c *Config, v string) error { c.DomainTemplate = v; return nil },
+	},
+	{
+		name:  "update-interval",
+		usage: "`interval` between route reconciliations",
+		get:   func(c *Config) string { return c.UpdateInterval.String() },
+		apply: func(c *Config, v string) error { return parseDuration(&c.UpdateInterval, v) },
+	},
+	{
+		name:  "retry-attempts",
+		usage: "`number` of retries for failed operations and proxied requests, negative for unlimited",
+		get:   func(c *Config) string { return strconv.Itoa(c.RetryAttempts) },
+		apply: func(c *Config, v string) error { return parseInt(&c.RetryAttempts, v) },
+	},
+	{
+		name:  "retry-delay",
+		usage: "`delay` between retries",
+		get:   func(c *Config) string { return c.RetryDelay.String() },
+		apply: func(c *Config, v string) error { return parseDuration(&c.RetryDelay, v) },
+	},
+	{
+		name:  "dial-timeout",
+		usage: "maximum `duration` to connect to an upstream",
+		get:   func(c *Config) string { return c.DialTimeout.String() },
+		apply: func(c *Config, v string) error { return parseDuration(&c.DialTimeout, v) },
+	},
+	{
+		name:  "response-header-timeout",
+		usage: "maximum `duration` to wait for an upstream's response headers, 0 for no limit",
+		get:   func(c *Config) string { return c.ResponseHeaderTimeout.String() },
+		apply: func(c *Config, v string) error { return parseDuration(&c.ResponseHeaderTimeout, v) },
+	},
+	{
+		name:  "request-timeout",
+		usage: "maximum `duration` of a proxied request including the response body, 0 for no limit",
+		get:   func(c *Config) string { return c.RequestTimeout.String() },
+		apply: func(c *Config, v string) error { return parseDuration(&c.RequestTimeout, v) },
+	},
+	{
+		name:  "idle-conn-timeout",
+		usage: "`duration` an idle connection to an upstream is kept open",
+		get:   func(c *Config) string { return c.IdleConnTimeout.String() },
+		apply: func(c *Config, v string) error { return parseDuration(&c.IdleConnTimeout, v) },
+	},
+	{
+		name:  "max-idle-conns",
+		usage: "`number` of idle connections kept open to each upstream",
+		get:   func(c *Config) string { return strconv.Itoa(c.MaxIdleConns) },
+		apply: func(c *Config, v string) error { return parseInt(&c.MaxIdleConns, v) },
+	},
+	{
+		name:  "flush-interval",
+		usage: "`interval` between flushes of streamed responses, negative to flush after every write",
+		get:   func(c *Config) string { return c.FlushInterval.String() },
+		apply: func(c *Config, v string) error { return parseDuration(&c.FlushInterval, v) },
+	},
+	{
+		name:  "read-header-timeout",
+		usage: "maximum `duration` to read a client's request headers",
+		get:   func(c *Config) string { return c.ReadHeaderTimeout.String() },
+		apply: func(c *Config, v string) error { return parseDuration(&c.ReadHeaderTimeout, v) },
+	},
+	{
+		name:  "read-timeout",
+		usage: "maximum `duration` to read a client's request including the body, 0 for no limit",
+		get:   func(c *Config) string { return c.ReadTimeout.String() },
+		apply: func(c *Config, v string) error { return parseDuration(&c.ReadTimeout, v) },
+	},
+	{
+		name:  "write-timeout",
+		usage: "maximum `duration` to write a response to a client, 0 for no limit",
+		get:   func(c *Config) string { return c.WriteTimeout.String() },
+		apply: func(c *Config, v string) error { return parseDuration(&c.WriteTimeout, v) },
+	},
+	{
+		name:  "idle-timeout",
+		usage: "`duration` an idle client connection is kept open",
+		get:   func(c *Config) string { return c.IdleTimeout.String() },
+		apply: func(c *Config, v string) error { return parseDuration(&c.IdleTimeout, v) },
+	},
+	{
+		name:  "log-level",
+		usage: "log `level`: trace, debug, info, warn or error",
+		get:   func(c *Config) string { return c.LogLevel },
+		apply: func(c *Config, v string) error { c.LogLevel = v; return nil },
+	},
+}
+
+func (s setting) envName() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+}
+
+// Load builds the configuration from, in increasing order of precedence, the
+// defaults, the optional YAML config file, DOCKNAME_* environment variables
+// and command-line flags. The result is validated before it is returned.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	fs := flag.NewFlagSet("dockname", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to a YAML config file (env DOCKNAME_CONFIG)")
+
+	defaults := Default()
+	flagValues := make(map[string]string)
+	for _, s := range settings {
+		name := s.name
+		usage := fmt.Sprintf("%s (default %q, env %s)", s.usage, s.get(defaults), s.envName())
+		fs.Func(name, usage, func(v string) error {
+			flagValues[name] = v
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := defaults
+
+	path := *configPath
+	if path == "" {
+		path, _ = lookupEnv(envPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := lookupEnv(s.envName()); ok {
+			if err := s.apply(cfg, v); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", s.envName(), err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := flagValues[s.name]; ok {
+			if err := s.apply(cfg, v); err != nil {
+				return nil, fmt.Errorf("invalid -%s: %w", s.name, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Port == "" {
+		errs = append(errs, errors.New("port must not be empty"))
+	}
+	listeners := []struct{ name, addr string }{
+		{"port", c.Port},
+		{"https_port", c.HTTPSPort},
+		{"admin_port", c.AdminPort},
+		{"tcp_port", c.TCPPort},
+	}
+	seen := make(map[string]string)
+	for _, l := range listeners {
+		if l.addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(l.addr); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", l.name, err))
+			continue
+		}
+		if other, ok := seen[l.addr]; ok {
+			errs = append(errs, fmt.Errorf("%s and %s use the same address %s", other, l.name, l.addr))
+		}
+		seen[l.addr] = l.name
+	}
+
+	if c.HTTPSPort != "" && c.CertDir == "" {
+		errs = append(errs, errors.New("cert_dir must not be empty when HTTPS is enabled"))
+	}
+	if c.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("shutdown_timeout must not be negative"))
+	}
+	if c.DomainTemplate != "" {
+		if err := proxy.ValidateDomainTemplate(c.DomainTemplate); err != nil {
+			errs = append(errs, fmt.Errorf("domain_template: %w", err))
+		}
+	}
+	if c.UpdateInterval <= 0 {
+		errs = append(errs, errors.New("update_interval must be positive"))
+	}
+	if c.RetryDelay < 0 {
+		errs = append(errs, errors.New("retry_delay must not be negative"))
+	}
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"dial_timeout", c.DialTimeout},
+		{"response_header_timeout", c.ResponseHeaderTimeout},
+		{"request_timeout", c.RequestTimeout},
+		{"idle_conn_timeout", c.IdleConnTimeout},
+		{"read_header_timeout", c.ReadHeaderTimeout},
+		{"read_timeout", c.ReadTimeout},
+		{"write_timeout", c.WriteTimeout},
+		{"idle_timeout", c.IdleTimeout},
+	}
+	for _, t := range timeouts {
+		if t.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", t.name))
+		}
+	}
+	if c.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("max_idle_conns must not be negative"))
+	}
+	if _, err := zerolog.ParseLevel(c.LogLevel); err != nil || c.LogLevel == "" {
+		errs = append(errs, fmt.Errorf("unknown log_level: %q", c.LogLevel))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) Level() zerolog.Level {
+	level, err := zerolog.ParseLevel(c.LogLevel)
+	if err != nil {
+		return zerolog.InfoLevel
+	}
+	return level
+}
+
+func parseDuration(dst *time.Duration, value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+func parseInt(dst *int, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
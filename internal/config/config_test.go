@@ -0,0 +1,230 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dockname.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func envLookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func TestLoad(t *testing.T) {
+	configFile := writeConfigFile(t, `
+port: ":8000"
+https_port: ":8443"
+update_interval: 30s
+retry_attempts: 5
+log_level: warn
+`)
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		check   func(t *testing.T, c *Config)
+		wantErr bool
+	}{
+		{
+			name: "Success: Defaults are used without overrides",
+			check: func(t *testing.T, c *Config) {
+				if c.Port != ":80" || c.HTTPSPort != ":443" || c.AdminPort != "" || c.UpdateInterval != 10*time.Second || c.LogLevel != "info" {
+					t.Errorf("Load() = %+v, want defaults", c)
+				}
+			},
+		},
+		{
+			name: "Success: Config file overrides defaults",
+			args: []string{"-config", configFile},
+			check: func(t *testing.T, c *Config) {
+				if c.Port != ":8000" || c.UpdateInterval != 30*time.Second || c.RetryAttempts != 5 || c.LogLevel != "warn" {
+					t.Errorf("Load() = %+v, want values from config file", c)
+				}
+				if c.RetryDelay != time.Second {
+					t.Errorf("Load() RetryDelay = %v, want default 1s", c.RetryDelay)
+				}
+			},
+		},
+		{
+			name: "Success: Environment overrides config file",
+			env: map[string]string{
+				"DOCKNAME_CONFIG":         configFile,
+				"DOCKNAME_PORT":           ":9000",
+				"DOCKNAME_RETRY_ATTEMPTS": "1",
+			},
+			check: func(t *testing.T, c *Config) {
+				if c.Port != ":9000" || c.RetryAttempts != 1 || c.HTTPSPort != ":8443" {
+					t.Errorf("Load() = %+v, want environment over config file", c)
+				}
+			},
+		},
+		{
+			name: "Success: Flags override environment",
+			args: []string{"-port", ":7000", "-log-level", "debug", "-https-port", "", "-request-timeout", "30s"},
+			env: map[string]string{
+				"DOCKNAME_PORT":      ":9000",
+				"DOCKNAME_LOG_LEVEL": "error",
+			},
+			check: func(t *testing.T, c *Config) {
+				if c.Port != ":7000" || c.LogLevel != "debug" || c.HTTPSPort != "" || c.RequestTimeout != 30*time.Second {
+					t.Errorf("Load() = %+v, want flags over environment", c)
+				}
+			},
+		},
+		{
+			name:    "Error: Invalid duration in environment",
+			env:     map[string]string{"DOCKNAME_UPDATE_INTERVAL": "soon"},
+			wantErr: true,
+		},
+		{
+			name:    "Error: Unknown flag",
+			args:    []string{"-unknown"},
+			wantErr: true,
+		},
+		{
+			name:    "Error: Missing config file",
+			args:    []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")},
+			wantErr: true,
+		},
+		{
+			name:    "Error: Unknown key in config file",
+			args:    []string{"-config", writeConfigFile(t, "prot: \":80\"\n")},
+			wantErr: true,
+		},
+		{
+			name:    "Error: Validation fails",
+			args:    []string{"-admin-port", ":80"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Load(tt.args, envLookup(tt.env))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr bool
+	}{
+		{
+			name:    "Success: Default config is valid",
+			modify:  func(_ *Config) {},
+			wantErr: false,
+		},
+		{
+			name:    "Success: Optional listeners can be disabled",
+			modify:  func(c *Config) { c.HTTPSPort = ""; c.AdminPort = "" },
+			wantErr: false,
+		},
+		{
+			name:    "Error: Empty HTTP port",
+			modify:  func(c *Config) { c.Port = "" },
+			wantErr: true,
+		},
+		{
+			name:    "Error: Port without colon",
+			modify:  func(c *Config) { c.Port = "80" },
+			wantErr: true,
+		},
+		{
+			name:    "Error: Listeners share an address",
+			modify:  func(c *Config) { c.HTTPSPort = ":80" },
+			wantErr: true,
+		},
+		{
+			name:    "Success: TCP listener",
+			modify:  func(c *Config) { c.TCPPort = ":5433" },
+			wantErr: false,
+		},
+		{
+			name:    "Error: TCP listener shares the HTTPS address",
+			modify:  func(c *Config) { c.TCPPort = ":443" },
+			wantErr: true,
+		},
+		{
+			name:    "Error: Non-positive update interval",
+			modify:  func(c *Config) { c.UpdateInterval = 0 },
+			wantErr: true,
+		},
+		{
+			name:    "Success: Negative retry attempts mean unlimited",
+			modify:  func(c *Config) { c.RetryAttempts = -1 },
+			wantErr: false,
+		},
+		{
+			name:    "Error: Negative retry delay",
+			modify:  func(c *Config) { c.RetryDelay = -time.Second },
+			wantErr: true,
+		},
+		{
+			name:    "Success: Zero timeouts disable the limit",
+			modify:  func(c *Config) { c.RequestTimeout = 0; c.WriteTimeout = 0; c.DialTimeout = 0 },
+			wantErr: false,
+		},
+		{
+			name:    "Error: Negative timeout",
+			modify:  func(c *Config) { c.ResponseHeaderTimeout = -time.Second },
+			wantErr: true,
+		},
+		{
+			name:    "Error: Negative idle connection limit",
+			modify:  func(c *Config) { c.MaxIdleConns = -1 },
+			wantErr: true,
+		},
+		{
+			name:    "Success: Domain template",
+			modify:  func(c *Config) { c.DomainTemplate = "{{.ComposeService}}.{{.ComposeProject}}.localhost" },
+			wantErr: false,
+		},
+		{
+			name:    "Error: Malformed domain template",
+			modify:  func(c *Config) { c.DomainTemplate = "{{.Name}.localhost" },
+			wantErr: true,
+		},
+		{
+			name:    "Error: Domain template with unknown field",
+			modify:  func(c *Config) { c.DomainTemplate = "{{.Service}}.localhost" },
+			wantErr: true,
+		},
+		{
+			name:    "Error: Unknown log level",
+			modify:  func(c *Config) { c.LogLevel = "verbose" },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.modify(c)
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
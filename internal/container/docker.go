@@ -2,6 +2,8 @@ package container
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
@@ -34,6 +36,12 @@ func (m *DockerManager) InspectContainer(ctx context.Context, containerID string
 	return m.client.ContainerInspect(ctx, containerID)
 }
 
-func (m *DockerManager) WatchEvents(ctx context.Context) (<-chan events.Message, <-chan error) {
-	return m.client.Events(ctx, types.EventsOptions{})
+// WatchEvents streams Docker events. When since is set, events that happened
+// after it are replayed before live events are delivered.
+func (m *DockerManager) WatchEvents(ctx context.Context, since time.Time) (<-chan events.Message, <-chan error) {
+	options := types.EventsOptions{}
+	if !since.IsZero() {
+		options.Since = fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())
+	}
+	return m.client.Events(ctx, options)
 }
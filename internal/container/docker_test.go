@@ -3,6 +3,7 @@ package container
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -133,7 +134,7 @@ func TestDockerManager_WatchEvents(t *testing.T) {
 				tt.setup(manager)
 			}
 
-			events, errs := manager.WatchEvents(context.Background())
+			events, errs := manager.WatchEvents(context.Background(), time.Time{})
 			if events == nil {
 				t.Error("WatchEvents() returned nil events channel")
 			}
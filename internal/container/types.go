@@ -2,6 +2,7 @@ package container
 
 import (
 	"context"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
@@ -10,7 +11,7 @@ import (
 type Manager interface {
 	ListContainers(ctx context.Context) ([]types.Container, error)
 	InspectContainer(ctx context.Context, id string) (types.ContainerJSON, error)
-	WatchEvents(ctx context.Context) (<-chan events.Message, <-chan error)
+	WatchEvents(ctx context.Context, since time.Time) (<-chan events.Message, <-chan error)
 }
 
 type Container struct {
@@ -2,6 +2,7 @@ package events
 
 import (
 	"context"
+	"strings"
 
 	"github.com/docker/docker/api/types/events"
 	"github.com/rs/zerolog"
@@ -18,6 +19,9 @@ const (
 	EventStop  EventType = "stop"
 	EventDie   EventType = "die"
 	EventKill  EventType = "kill"
+	// EventHealthStatus is sent as "health_status: <status>" whenever the
+	// result of a container's health check changes
+	EventHealthStatus EventType = "health_status"
 )
 
 type Manager struct {
@@ -37,7 +41,8 @@ func (m *Manager) RegisterHandler(eventType EventType, handler Handler) {
 }
 
 func (m *Manager) HandleEvent(ctx context.Context, event events.Message) error {
-	eventType := EventType(event.Action)
+	action, _, _ := strings.Cut(event.Action, ":")
+	eventType := EventType(action)
 	handlers, exists := m.handlers[eventType]
 	if !exists {
 		return nil
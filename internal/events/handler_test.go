@@ -52,6 +52,12 @@ func TestEventManager_HandleEvent(t *testing.T) {
 			wantErr:     true,
 			wantHandled: 1,
 		},
+		{
+			name:        "Success: Action with a status suffix is dispatched by its type",
+			eventType:   "health_status: healthy",
+			wantErr:     false,
+			wantHandled: 1,
+		},
 		{
 			name:      "Success: Unregistered event type is ignored",
 			eventType: "unknown",
@@ -76,6 +82,7 @@ func TestEventManager_HandleEvent(t *testing.T) {
 			// Create event manager
 			manager := NewManager(zerolog.Nop())
 			manager.RegisterHandler(EventStart, mockHandler)
+			manager.RegisterHandler(EventHealthStatus, mockHandler)
 
 			// Create test event
 			testEvent := events.Message{
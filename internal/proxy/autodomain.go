@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	labelEnable         = "dockname.enable"
+	labelComposeService = "com.docker.compose.service"
+	labelComposeProject = "com.docker.compose.project"
+)
+
+// domainTemplateData is the data a domain template is executed with. Every
+// field is lower-cased and reduced to characters valid in a host name label.
+type domainTemplateData struct {
+	Name           string
+	ComposeService string
+	ComposeProject string
+}
+
+// sampleDomainTemplateData is executed against a parsed domain template so
+// that references to unknown fields are reported up front rather than for
+// every container.
+var sampleDomainTemplateData = domainTemplateData{
+	Name:           "app",
+	ComposeService: "web",
+	ComposeProject: "project",
+}
+
+func parseDomainTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("domain").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, sampleDomainTemplateData); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// ValidateDomainTemplate reports whether text parses and executes as a domain
+// template, which rejects references to fields other than Name,
+// ComposeService and ComposeProject.
+func ValidateDomainTemplate(text string) error {
+	_, err := parseDomainTemplate(text)
+	return err
+}
+
+// routeSpecs returns the routes of a container. Containers labeled
+// dockname.enable=false are never routed. When a domain template is configured,
+// containers without a domain label get the domain it generates.
+func (m *Manager) routeSpecs(container types.Container) []routeSpec {
+	if enabled, err := strconv.ParseBool(container.Labels[labelEnable]); err == nil && !enabled {
+		return nil
+	}
+
+	specs := parseRouteLabels(container.Labels)
+	if len(specs) > 0 || m.domainTemplate == nil {
+		return specs
+	}
+
+	domain, ok := m.generateDomain(container)
+	if !ok {
+		return nil
+	}
+	labels := make(map[string]string, len(container.Labels)+1)
+	for key, value := range container.Labels {
+		labels[key] = value
+	}
+	labels[serviceLabel("", optionDomain)] = domain
+	return parseRouteLabels(labels)
+}
+
+func (m *Manager) generateDomain(container types.Container) (string, bool) {
+	data := domainTemplateData{
+		Name:           hostLabel(containerName(container)),
+		ComposeService: hostLabel(container.Labels[labelComposeService]),
+		ComposeProject: hostLabel(container.Labels[labelComposeProject]),
+	}
+
+	var buf bytes.Buffer
+	if err := m.domainTemplate.Execute(&buf, data); err != nil {
+		m.logger.Warn().Err(err).Str("container_id", container.ID).Msg("failed to generate domain")
+		return "", false
+	}
+
+	// Fields missing on a container, such as the Compose labels of a container
+	// started with docker run, leave empty labels behind
+	domain := strings.TrimSpace(buf.String())
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" {
+			m.logger.Debug().
+				Str("container_id", container.ID).
+				Str("domain", domain).
+				Msg("generated domain is incomplete, skipping container")
+			return "", false
+		}
+	}
+	return domain, true
+}
+
+// hostLabel lower-cases the value and replaces every character that is not
+// allowed in a host name label with a dash.
+func hostLabel(value string) string {
+	value = strings.ToLower(value)
+	label := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, value)
+	return strings.Trim(label, "-")
+}
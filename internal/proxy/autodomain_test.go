@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/rs/zerolog"
+)
+
+func TestManager_RouteSpecs(t *testing.T) {
+	composeLabels := map[string]string{
+		"com.docker.compose.service": "web_app",
+		"com.docker.compose.project": "Shop",
+	}
+
+	tests := []struct {
+		name      string
+		template  string
+		container types.Container
+		want      []string
+	}{
+		{
+			name:     "Success: Compose service and project",
+			template: "{{.ComposeService}}.{{.ComposeProject}}.localhost",
+			container: types.Container{
+				ID:     "container1",
+				Names:  []string{"/shop-web_app-1"},
+				Labels: composeLabels,
+			},
+			want: []string{"web-app.shop.localhost"},
+		},
+		{
+			name:     "Success: Container name",
+			template: "{{.Name}}.localhost",
+			container: types.Container{
+				ID:    "container1",
+				Names: []string{"/My_Service"},
+			},
+			want: []string{"my-service.localhost"},
+		},
+		{
+			name:     "Success: Domain label takes precedence over the template",
+			template: "{{.Name}}.localhost",
+			container: types.Container{
+				ID:     "container1",
+				Names:  []string{"/web"},
+				Labels: map[string]string{"dockname.domain": "app.localhost"},
+			},
+			want: []string{"app.localhost"},
+		},
+		{
+			name: "Success: Template is disabled by default",
+			container: types.Container{
+				ID:    "container1",
+				Names: []string{"/web"},
+			},
+			want: nil,
+		},
+		{
+			name:     "Error: Missing Compose labels leave the domain incomplete",
+			template: "{{.ComposeService}}.{{.ComposeProject}}.localhost",
+			container: types.Container{
+				ID:    "container1",
+				Names: []string{"/web"},
+			},
+			want: nil,
+		},
+		{
+			name:     "Error: Template with an unknown field is disabled",
+			template: "{{.Service}}.localhost",
+			container: types.Container{
+				ID:     "container1",
+				Names:  []string{"/web"},
+				Labels: composeLabels,
+			},
+			want: nil,
+		},
+		{
+			name:     "Error: Opted out container is skipped",
+			template: "{{.Name}}.localhost",
+			container: types.Container{
+				ID:     "container1",
+				Names:  []string{"/web"},
+				Labels: map[string]string{"dockname.enable": "false", "dockname.domain": "app.localhost"},
+			},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.DomainTemplate = tt.template
+			manager := NewManager(&mockManager{}, config, zerolog.Nop())
+
+			var got []string
+			for _, spec := range manager.routeSpecs(tt.container) {
+				got = append(got, spec.Domains...)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routeSpecs() domains = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
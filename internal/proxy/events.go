@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/kiwamizamurai/dockname/internal/proxy/handler"
+)
+
+type containerStartHandler struct {
+	manager *Manager
+}
+
+func (h *containerStartHandler) HandleEvent(ctx context.Context, event events.Message) error {
+	containerID := eventContainerID(event)
+
+	containerJSON, err := h.manager.containerManager.InspectContainer(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+
+	if containerJSON.Config == nil {
+		h.manager.logger.Debug().
+			Str("container_id", containerID).
+			Msg("container config not found, skipping container")
+		return nil
+	}
+
+	container := types.Container{
+		ID:     containerID,
+		Names:  []string{containerJSON.Name},
+		Labels: containerJSON.Config.Labels,
+	}
+
+	routes := h.manager.containerRoutes(container)
+	if routes.empty() {
+		h.manager.logger.Debug().
+			Str("container_id", containerID).
+			Msg("no route configured, skipping container")
+		return nil
+	}
+
+	return h.manager.addContainerRoutes(container, containerJSON, routes)
+}
+
+type containerStopHandler struct {
+	manager *Manager
+}
+
+func (h *containerStopHandler) HandleEvent(_ context.Context, event events.Message) error {
+	h.manager.unregisterContainer(eventContainerID(event))
+	return nil
+}
+
+// containerKillHandler removes routes on kill only when the container has
+// actually stopped, since signals such as HUP are commonly used for reloads
+// and die follows every real exit anyway.
+type containerKillHandler struct {
+	manager *Manager
+}
+
+func (h *containerKillHandler) HandleEvent(ctx context.Context, event events.Message) error {
+	containerID := eventContainerID(event)
+
+	containerJSON, err := h.manager.containerManager.InspectContainer(ctx, containerID)
+	if err == nil && containerJSON.ContainerJSONBase != nil && containerJSON.State != nil && containerJSON.State.Running {
+		h.manager.logger.Debug().
+			Str("container_id", containerID).
+			Str("signal", event.Actor.Attributes["signal"]).
+			Msg("container still running after kill, keeping routes")
+		return nil
+	}
+
+	h.manager.unregisterContainer(containerID)
+	return nil
+}
+
+type containerHealthHandler struct {
+	manager *Manager
+}
+
+func (h *containerHealthHandler) HandleEvent(_ context.Context, event events.Message) error {
+	_, status, _ := strings.Cut(event.Action, ":")
+	h.manager.setContainerHealth(eventContainerID(event), handler.ParseHealthStatus(strings.TrimSpace(status)))
+	return nil
+}
+
+func eventContainerID(event events.Message) string {
+	if event.Actor.ID != "" {
+		return event.Actor.ID
+	}
+	return event.ID
+}
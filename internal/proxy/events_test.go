@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/rs/zerolog"
+)
+
+func testContainerJSON(id string, labels map[string]string, ip string) types.ContainerJSON {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:   id,
+			Name: "/" + id,
+		},
+		Config: &container.Config{
+			Labels: labels,
+		},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"bridge": {
+					IPAddress: ip,
+				},
+			},
+		},
+	}
+}
+
+func TestManager_ContainerEvents(t *testing.T) {
+	containers := map[string]types.ContainerJSON{
+		"container1": testContainerJSON("container1", map[string]string{
+			"dockname.domain": "app.localhost",
+			"dockname.port":   "8080",
+		}, "172.17.0.2"),
+		"container2": testContainerJSON("container2", map[string]string{
+			"dockname.domain": "app.localhost",
+			"dockname.port":   "8080",
+		}, "172.17.0.3"),
+		"container3": testContainerJSON("container3", map[string]string{}, "172.17.0.4"),
+		"container4": testContainerJSON("container4", map[string]string{
+			"dockname.app.domain":   "app.localhost",
+			"dockname.app.port":     "3000",
+			"dockname.admin.domain": "admin.localhost",
+			"dockname.admin.port":   "9000",
+		}, "172.17.0.5"),
+		"container5": testContainerJSON("container5", map[string]string{
+			"dockname.domain":        "app.localhost",
+			"dockname.app.domain":    "app.localhost",
+			"dockname.admin.domain":  "admin.localhost",
+			"dockname.admin.network": "missing",
+		}, "172.17.0.6"),
+		"container6": testContainerJSON("container6", map[string]string{
+			"dockname.domain":  "app.localhost,www.app.localhost",
+			"dockname.aliases": "legacy.localhost",
+		}, "172.17.0.7"),
+		"container7": testContainerJSON("container7", map[string]string{
+			"dockname.domain": "reload.localhost",
+		}, "172.17.0.8"),
+	}
+	containers["container7"].State = &types.ContainerState{Running: true}
+
+	tests := []struct {
+		name       string
+		events     []events.Message
+		wantRoutes map[string][]string
+		wantErr    bool
+	}{
+		{
+			name: "Success: Start event registers route",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container1"}},
+			},
+			wantRoutes: map[string][]string{"app.localhost": {"container1"}},
+		},
+		{
+			name: "Success: Unlabeled container is skipped",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container3"}},
+			},
+			wantRoutes: map[string][]string{},
+		},
+		{
+			name: "Success: Stop event removes route",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container1"}},
+				{Type: "container", Action: "stop", Actor: events.Actor{ID: "container1"}},
+			},
+			wantRoutes: map[string][]string{},
+		},
+		{
+			name: "Success: Die and kill events remove route",
+			events: []events.Message{
+				{Type: "container", Action: "start", ID: "container1"},
+				{Type: "container", Action: "kill", ID: "container1"},
+				{Type: "container", Action: "die", ID: "container1"},
+			},
+			wantRoutes: map[string][]string{},
+		},
+		{
+			name: "Success: Kill event for a running container keeps route",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container7"}},
+				{Type: "container", Action: "kill", Actor: events.Actor{ID: "container7", Attributes: map[string]string{"signal": "1"}}},
+			},
+			wantRoutes: map[string][]string{"reload.localhost": {"container7"}},
+		},
+		{
+			name: "Success: Kill event for a stopped container removes route",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container1"}},
+				{Type: "container", Action: "kill", Actor: events.Actor{ID: "container1", Attributes: map[string]string{"signal": "9"}}},
+			},
+			wantRoutes: map[string][]string{},
+		},
+		{
+			name: "Success: Replicas sharing a domain join the same pool",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container1"}},
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container2"}},
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container1"}},
+			},
+			wantRoutes: map[string][]string{"app.localhost": {"container2", "container1"}},
+		},
+		{
+			name: "Success: Stopping a replica keeps the remaining ones",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container1"}},
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container2"}},
+				{Type: "container", Action: "stop", Actor: events.Actor{ID: "container1"}},
+			},
+			wantRoutes: map[string][]string{"app.localhost": {"container2"}},
+		},
+		{
+			name: "Success: Named services register separate routes",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container4"}},
+			},
+			wantRoutes: map[string][]string{"admin.localhost": {"container4"}, "app.localhost": {"container4"}},
+		},
+		{
+			name: "Success: Stop event removes every service route",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container4"}},
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container1"}},
+				{Type: "container", Action: "stop", Actor: events.Actor{ID: "container4"}},
+			},
+			wantRoutes: map[string][]string{"app.localhost": {"container1"}},
+		},
+		{
+			name: "Success: Domains and aliases are registered",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container6"}},
+			},
+			wantRoutes: map[string][]string{
+				"app.localhost":     {"container6"},
+				"www.app.localhost": {"container6"},
+				"legacy.localhost":  {"container6"},
+			},
+		},
+		{
+			name: "Success: Stop event removes every alias",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container6"}},
+				{Type: "container", Action: "stop", Actor: events.Actor{ID: "container6"}},
+			},
+			wantRoutes: map[string][]string{},
+		},
+		{
+			name: "Error: Failing services do not block the others",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "container5"}},
+			},
+			wantRoutes: map[string][]string{"app.localhost": {"container5"}},
+			wantErr:    true,
+		},
+		{
+			name: "Error: Container inspection fails",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "missing"}},
+			},
+			wantRoutes: map[string][]string{},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockManager := &mockManager{
+				InspectContainerFn: func(_ context.Context, containerID string) (types.ContainerJSON, error) {
+					containerJSON, ok := containers[containerID]
+					if !ok {
+						return types.ContainerJSON{}, errors.New("no such container")
+					}
+					return containerJSON, nil
+				},
+			}
+			manager := NewManager(mockManager, nil, zerolog.Nop())
+
+			var err error
+			for _, event := range tt.events {
+				if handleErr := manager.eventManager.HandleEvent(context.Background(), event); handleErr != nil {
+					err = handleErr
+				}
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("HandleEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			gotRoutes := make(map[string][]string)
+			for _, route := range manager.proxyHandler.GetRoutes() {
+				for _, upstream := range route.Upstreams {
+					gotRoutes[route.Host] = append(gotRoutes[route.Host], upstream.ID)
+				}
+			}
+			if !reflect.DeepEqual(gotRoutes, tt.wantRoutes) {
+				t.Errorf("routes = %v, want %v", gotRoutes, tt.wantRoutes)
+			}
+		})
+	}
+}
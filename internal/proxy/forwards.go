@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/kiwamizamurai/dockname/internal/proxy/tcp"
+)
+
+// forwardSpec is a port dockname listens on and the container port its
+// traffic is forwarded to.
+type forwardSpec struct {
+	Listen        tcp.Port
+	ContainerPort string
+	Network       string
+}
+
+// parseForwardLabels returns the ports declared by dockname.tcp.listen and
+// dockname.udp.listen. Both hold a comma-separated list of ports, each either
+// forwarded to the same container port or written <port>:<container port>.
+// Invalid entries are skipped.
+func parseForwardLabels(labels map[string]string) []forwardSpec {
+	var specs []forwardSpec
+	for _, option := range []struct{ name, network string }{
+		{optionTCPListen, tcp.NetworkTCP},
+		{optionUDPListen, tcp.NetworkUDP},
+	} {
+		seen := make(map[int]bool)
+		for _, entry := range strings.Split(labels[labelPrefix+option.name], ",") {
+			listen, containerPort, hasContainerPort := strings.Cut(strings.TrimSpace(entry), ":")
+			if !hasContainerPort {
+				containerPort = listen
+			}
+			port, err := parsePortNumber(listen)
+			if err != nil || seen[port] {
+				continue
+			}
+			if _, err := parsePortNumber(containerPort); err != nil {
+				continue
+			}
+			seen[port] = true
+			specs = append(specs, forwardSpec{
+				Listen:        tcp.Port{Network: option.network, Port: port},
+				ContainerPort: containerPort,
+				Network:       labels[labelPrefix+optionNetwork],
+			})
+		}
+	}
+	return specs
+}
+
+func parsePortNumber(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port: %q", value)
+	}
+	return port, nil
+}
+
+// addForwards adds the container as a backend of each of its forwarded ports
+// and returns the ports it was added on. It must be called with
+// containersLock held.
+func (m *Manager) addForwards(container types.Container, containerJSON types.ContainerJSON, specs []forwardSpec) ([]tcp.Port, error) {
+	var errs []error
+	var ports []tcp.Port
+	for _, spec := range specs {
+		networkName, containerIP, err := selectNetwork(containerJSON.NetworkSettings.Networks, spec.Network, m.config.Network, m.ownNetworks)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s", err, container.ID))
+			continue
+		}
+
+		backend := &tcp.Backend{
+			ID:            container.ID,
+			ContainerName: containerName(container),
+			Address:       net.JoinHostPort(containerIP, spec.ContainerPort),
+		}
+		if err := m.forwarder.AddBackend(spec.Listen, backend); err != nil {
+			errs = append(errs, fmt.Errorf("failed to forward port %s: %w", spec.Listen, err))
+			continue
+		}
+		ports = append(ports, spec.Listen)
+
+		m.logger.Info().
+			Str("container_id", container.ID).
+			Str("network", networkName).
+			Str("port", spec.Listen.String()).
+			Str("target", backend.Address).
+			Msg("Registered container for port forwarding")
+	}
+	return ports, errors.Join(errs...)
+}
+
+func (m *Manager) removeForward(containerID string, port tcp.Port) {
+	m.forwarder.RemoveBackend(port, containerID)
+
+	m.logger.Info().
+		Str("container_id", containerID).
+		Str("port", port.String()).
+		Msg("Unregistered container for port forwarding")
+}
+
+func containsPort(ports []tcp.Port, port tcp.Port) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/kiwamizamurai/dockname/internal/proxy/tcp"
+	"github.com/rs/zerolog"
+)
+
+func TestParseForwardLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []forwardSpec
+	}{
+		{
+			name: "Success: TCP and UDP ports are parsed",
+			labels: map[string]string{
+				"dockname.tcp.listen": "5432, 15432:5433",
+				"dockname.udp.listen": "53",
+				"dockname.network":    "backend",
+			},
+			want: []forwardSpec{
+				{Listen: tcp.Port{Network: "tcp", Port: 5432}, ContainerPort: "5432", Network: "backend"},
+				{Listen: tcp.Port{Network: "tcp", Port: 15432}, ContainerPort: "5433", Network: "backend"},
+				{Listen: tcp.Port{Network: "udp", Port: 53}, ContainerPort: "53", Network: "backend"},
+			},
+		},
+		{
+			name: "Success: Invalid and duplicate entries are skipped",
+			labels: map[string]string{
+				"dockname.tcp.listen": "postgres,0,70000,6379:redis,6379,6379:6380,",
+			},
+			want: []forwardSpec{
+				{Listen: tcp.Port{Network: "tcp", Port: 6379}, ContainerPort: "6379"},
+			},
+		},
+		{
+			name:   "Error: No listen label",
+			labels: map[string]string{"dockname.tcp.domain": "db.localhost"},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseForwardLabels(tt.labels); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseForwardLabels() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_Forwards(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+	listen := strconv.Itoa(port)
+	tcpPort := tcp.Port{Network: "tcp", Port: port}
+
+	containers := map[string]types.ContainerJSON{
+		"postgres1": testContainerJSON("postgres1", map[string]string{"dockname.tcp.listen": listen + ":5432"}, "172.17.0.2"),
+		"postgres2": testContainerJSON("postgres2", map[string]string{"dockname.tcp.listen": listen + ":5432"}, "172.17.0.3"),
+	}
+	mockManager := &mockManager{
+		InspectContainerFn: func(_ context.Context, containerID string) (types.ContainerJSON, error) {
+			return containers[containerID], nil
+		},
+	}
+	manager := NewManager(mockManager, nil, zerolog.Nop())
+	defer manager.forwarder.Close()
+
+	handle := func(action, containerID string) {
+		t.Helper()
+		event := events.Message{Type: "container", Action: action, Actor: events.Actor{ID: containerID}}
+		if err := manager.eventManager.HandleEvent(context.Background(), event); err != nil {
+			t.Fatalf("HandleEvent(%s %s) error = %v", action, containerID, err)
+		}
+	}
+	backends := func() []string {
+		var addrs []string
+		for _, backend := range manager.forwarder.Backends(tcpPort) {
+			addrs = append(addrs, backend.Address)
+		}
+		return addrs
+	}
+	listening := func() bool {
+		conn, err := net.Dial("tcp", "127.0.0.1:"+listen)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}
+
+	handle("start", "postgres1")
+	handle("start", "postgres2")
+	if got, want := backends(), []string{"172.17.0.2:5432", "172.17.0.3:5432"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backends after start = %v, want %v", got, want)
+	}
+	if !listening() {
+		t.Error("forwarded port is not listening after start")
+	}
+
+	handle("stop", "postgres1")
+	if got, want := backends(), []string{"172.17.0.3:5432"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backends after stopping a replica = %v, want %v", got, want)
+	}
+
+	handle("die", "postgres2")
+	if got := backends(); got != nil {
+		t.Errorf("backends after stopping every replica = %v, want none", got)
+	}
+	if listening() {
+		t.Error("forwarded port still listening after its containers stopped")
+	}
+}
+
+func TestManager_Start_PortInUse(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+
+	containers := map[string]types.ContainerJSON{
+		"app": testContainerJSON("app", map[string]string{"dockname.domain": "app.localhost"}, "172.17.0.2"),
+		"postgres": testContainerJSON("postgres", map[string]string{
+			"dockname.tcp.listen": strconv.Itoa(busyPort) + ":5432",
+		}, "172.17.0.3"),
+	}
+	mockManager := &mockManager{
+		ListContainersFn: func(_ context.Context) ([]types.Container, error) {
+			return []types.Container{
+				{ID: "postgres", Labels: containers["postgres"].Config.Labels},
+				{ID: "app", Labels: containers["app"].Config.Labels},
+			}, nil
+		},
+		InspectContainerFn: func(_ context.Context, containerID string) (types.ContainerJSON, error) {
+			return containers[containerID], nil
+		},
+	}
+	config := &Config{
+		Port:            "127.0.0.1:0",
+		UpdateInterval:  50 * time.Millisecond,
+		ShutdownTimeout: time.Second,
+	}
+	manager := NewManager(mockManager, config, zerolog.Nop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- manager.Start(ctx)
+	}()
+
+	// The port is forwarded by a reconciliation once it is released
+	tcpPort := tcp.Port{Network: "tcp", Port: busyPort}
+	routed := func() bool {
+		return manager.proxyHandler.HasHost("app.localhost") && manager.forwarder.HasBackend(tcpPort, "postgres")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !manager.proxyHandler.HasHost("app.localhost") {
+		t.Error("app.localhost not routed while another container's port is in use")
+	}
+	if manager.forwarder.HasBackend(tcpPort, "postgres") {
+		t.Error("port in use reported as forwarded")
+	}
+	_ = busy.Close()
+	for deadline := time.Now().Add(2 * time.Second); !routed() && time.Now().Before(deadline); {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !routed() {
+		t.Error("containers not routed after the port was released")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Manager.Start() error = %v, want nil", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Manager.Start() did not return after context cancellation")
+	}
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	BalancerRoundRobin = "roundrobin"
+	BalancerLeastConn  = "leastconn"
+)
+
+type Balancer interface {
+	Next(upstreams []*Upstream) *Upstream
+}
+
+func NewBalancer(name string) (Balancer, error) {
+	switch name {
+	case "", BalancerRoundRobin:
+		return &roundRobinBalancer{}, nil
+	case BalancerLeastConn:
+		return &leastConnBalancer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown load balancer: %s", name)
+	}
+}
+
+type roundRobinBalancer struct {
+	counter uint64
+}
+
+func (b *roundRobinBalancer) Next(upstreams []*Upstream) *Upstream {
+	if len(upstreams) == 0 {
+		return nil
+	}
+	n := atomic.AddUint64(&b.counter, 1) - 1
+	return upstreams[n%uint64(len(upstreams))]
+}
+
+// leastConnBalancer picks the upstream with the fewest in-flight requests.
+// Ties are broken in round-robin order so idle replicas share the load.
+type leastConnBalancer struct {
+	counter uint64
+}
+
+func (b *leastConnBalancer) Next(upstreams []*Upstream) *Upstream {
+	if len(upstreams) == 0 {
+		return nil
+	}
+	offset := atomic.AddUint64(&b.counter, 1) - 1
+
+	var selected *Upstream
+	for i := range upstreams {
+		upstream := upstreams[(offset+uint64(i))%uint64(len(upstreams))]
+		if selected == nil || upstream.ActiveRequests() < selected.ActiveRequests() {
+			selected = upstream
+		}
+	}
+	return selected
+}
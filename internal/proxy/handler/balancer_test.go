@@ -0,0 +1,67 @@
+package handler
+
+import "testing"
+
+func TestNewBalancer(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "", wantErr: false},
+		{name: BalancerRoundRobin, wantErr: false},
+		{name: BalancerLeastConn, wantErr: false},
+		{name: "random", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run("balancer "+tt.name, func(t *testing.T) {
+			balancer, err := NewBalancer(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewBalancer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && balancer == nil {
+				t.Error("NewBalancer() returned nil balancer")
+			}
+		})
+	}
+}
+
+func TestRoundRobinBalancer_Next(t *testing.T) {
+	upstreams := []*Upstream{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	b := &roundRobinBalancer{}
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		got = append(got, b.Next(upstreams).ID)
+	}
+
+	want := []string{"a", "b", "c", "a", "b", "c"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Next() sequence = %v, want %v", got, want)
+		}
+	}
+
+	if b.Next(nil) != nil {
+		t.Error("Next() with empty pool should return nil")
+	}
+}
+
+func TestLeastConnBalancer_Next(t *testing.T) {
+	upstreams := []*Upstream{
+		{ID: "busy", activeRequests: 5},
+		{ID: "idle", activeRequests: 0},
+		{ID: "moderate", activeRequests: 2},
+	}
+	b := &leastConnBalancer{}
+
+	for i := 0; i < 3; i++ {
+		if got := b.Next(upstreams); got.ID != "idle" {
+			t.Errorf("Next() = %v, want idle", got.ID)
+		}
+	}
+
+	if b.Next(nil) != nil {
+		t.Error("Next() with empty pool should return nil")
+	}
+}
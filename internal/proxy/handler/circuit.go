@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// circuitFailureThreshold is the number of consecutive failed requests
+	// after which an upstream's circuit opens
+	circuitFailureThreshold = 5
+	// circuitOpenDuration is how long an open circuit rejects requests before
+	// a single trial request is let through
+	circuitOpenDuration = 10 * time.Second
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops traffic to an upstream after consecutive connection
+// errors or 5xx responses. Once openDuration has passed, one trial request is
+// let through: its success closes the circuit again, its failure reopens it.
+type circuitBreaker struct {
+	threshold    int
+	openDuration time.Duration
+
+	lock     sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		threshold:    circuitFailureThreshold,
+		openDuration: circuitOpenDuration,
+	}
+}
+
+func (b *circuitBreaker) State() CircuitState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state
+}
+
+// ready reports whether a request could be sent without changing the state.
+func (b *circuitBreaker) ready() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		return time.Since(b.openedAt) >= b.openDuration
+	case CircuitHalfOpen:
+		return false // A trial request is in flight
+	default:
+		return true
+	}
+}
+
+// allow reports whether a request may be sent, moving an open circuit whose
+// open duration has passed to half-open for a single trial request.
+func (b *circuitBreaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		return true
+	case CircuitHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state = CircuitClosed
+	b.failures = 0
+}
+
+// cancelled records a request that ended without a verdict on the upstream,
+// such as one the client gave up on. A trial request is retried by the next
+// request.
+func (b *circuitBreaker) cancelled() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == CircuitHalfOpen {
+		b.state = CircuitOpen
+	}
+}
+
+func (b *circuitBreaker) failure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name      string
+		steps     func(b *circuitBreaker)
+		wantState CircuitState
+		wantReady bool
+	}{
+		{
+			name: "Success: Failures below the threshold keep the circuit closed",
+			steps: func(b *circuitBreaker) {
+				for i := 0; i < circuitFailureThreshold-1; i++ {
+					b.failure()
+				}
+			},
+			wantState: CircuitClosed,
+			wantReady: true,
+		},
+		{
+			name: "Success: A success resets the failure count",
+			steps: func(b *circuitBreaker) {
+				for i := 0; i < circuitFailureThreshold-1; i++ {
+					b.failure()
+				}
+				b.success()
+				b.failure()
+			},
+			wantState: CircuitClosed,
+			wantReady: true,
+		},
+		{
+			name: "Error: Consecutive failures open the circuit",
+			steps: func(b *circuitBreaker) {
+				for i := 0; i < circuitFailureThreshold; i++ {
+					b.failure()
+				}
+			},
+			wantState: CircuitOpen,
+			wantReady: false,
+		},
+		{
+			name: "Success: Open circuit lets a single trial request through",
+			steps: func(b *circuitBreaker) {
+				b.openDuration = 0
+				for i := 0; i < circuitFailureThreshold; i++ {
+					b.failure()
+				}
+				if !b.allow() {
+					t.Error("allow() = false for the trial request, want true")
+				}
+				if b.allow() {
+					t.Error("allow() = true while the trial request is in flight, want false")
+				}
+			},
+			wantState: CircuitHalfOpen,
+			wantReady: false,
+		},
+		{
+			name: "Success: Successful trial request closes the circuit",
+			steps: func(b *circuitBreaker) {
+				b.openDuration = 0
+				for i := 0; i < circuitFailureThreshold; i++ {
+					b.failure()
+				}
+				b.allow()
+				b.success()
+			},
+			wantState: CircuitClosed,
+			wantReady: true,
+		},
+		{
+			name: "Error: Failed trial request reopens the circuit",
+			steps: func(b *circuitBreaker) {
+				for i := 0; i < circuitFailureThreshold; i++ {
+					b.failure()
+				}
+				b.openedAt = time.Now().Add(-b.openDuration)
+				b.allow()
+				b.failure()
+			},
+			wantState: CircuitOpen,
+			wantReady: false,
+		},
+		{
+			name: "Success: Cancelled trial request lets the next one try",
+			steps: func(b *circuitBreaker) {
+				b.openDuration = 0
+				for i := 0; i < circuitFailureThreshold; i++ {
+					b.failure()
+				}
+				b.allow()
+				b.cancelled()
+			},
+			wantState: CircuitOpen,
+			wantReady: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker()
+			tt.steps(b)
+			if got := b.State(); got != tt.wantState {
+				t.Errorf("State() = %v, want %v", got, tt.wantState)
+			}
+			if got := b.ready(); got != tt.wantReady {
+				t.Errorf("ready() = %v, want %v", got, tt.wantReady)
+			}
+		})
+	}
+}
+
+func TestProxyHandler_CircuitBreaking(t *testing.T) {
+	var failing int32 = 1
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Backend", "flaky")
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer flaky.Close()
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Backend", "stable")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer stable.Close()
+
+	upstreams := createTestUpstreams(t, flaky.URL, stable.URL)
+	h := NewProxyHandler(zerolog.Nop())
+	if err := h.AddRoute(Route{Host: "app.localhost", Upstreams: upstreams}); err != nil {
+		t.Fatalf("AddRoute() error = %v", err)
+	}
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "http://app.localhost/", nil))
+		return w
+	}
+
+	// Round-robin alternates between both replicas until the flaky one's
+	// circuit opens
+	for i := 0; i < 2*circuitFailureThreshold; i++ {
+		serve()
+	}
+	if got := upstreams[0].CircuitState(); got != CircuitOpen {
+		t.Fatalf("CircuitState() = %v, want %v", got, CircuitOpen)
+	}
+	for i := 0; i < 4; i++ {
+		if got := serve().Header().Get("X-Backend"); got != "stable" {
+			t.Errorf("backend with open circuit = %v, want stable", got)
+		}
+	}
+
+	// After the open duration a trial request reaches the recovered replica
+	atomic.StoreInt32(&failing, 0)
+	upstreams[0].breaker.lock.Lock()
+	upstreams[0].breaker.openedAt = time.Now().Add(-circuitOpenDuration)
+	upstreams[0].breaker.lock.Unlock()
+	for i := 0; i < 2; i++ {
+		serve()
+	}
+	if got := upstreams[0].CircuitState(); got != CircuitClosed {
+		t.Errorf("CircuitState() after trial request = %v, want %v", got, CircuitClosed)
+	}
+}
+
+func TestProxyHandler_BadGateway(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	upstreams := createTestUpstreams(t, backend.URL)
+	backend.Close()
+
+	h := NewProxyHandler(zerolog.Nop())
+	if err := h.AddRoute(Route{Host: "app.localhost", Upstreams: upstreams}); err != nil {
+		t.Fatalf("AddRoute() error = %v", err)
+	}
+
+	for i := 0; i < circuitFailureThreshold; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "http://app.localhost/", nil))
+		if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "Bad Gateway") {
+			t.Fatalf("ServeHTTP() = %v %q, want 502 error page", w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "http://app.localhost/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("ServeHTTP() with open circuit status = %v, want %v", w.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+// startingRetryAfter is the Retry-After hint, in seconds, sent while the
+// upstreams of a route are still starting.
+const startingRetryAfter = "5"
+
+// gRPC status codes sent in place of an error page to gRPC clients
+const (
+	grpcDeadlineExceeded = "4"
+	grpcUnavailable      = "14"
+)
+
+const errorPage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>%[1]s</title></head>
+<body>
+<h1>%[1]s</h1>
+<p>%[2]s</p>
+</body>
+</html>
+`
+
+func serveErrorPage(w http.ResponseWriter, r *http.Request, status int, title, message string) {
+	if isGRPCRequest(r) {
+		serveGRPCError(w, status, message)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, errorPage, html.EscapeString(title), html.EscapeString(message))
+}
+
+// serveGRPCError answers a gRPC request with a response without a body whose
+// headers carry the gRPC status, which gRPC clients report as the call's
+// error instead of a protocol error.
+func serveGRPCError(w http.ResponseWriter, status int, message string) {
+	code := grpcUnavailable
+	if status == http.StatusGatewayTimeout {
+		code = grpcDeadlineExceeded
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", code)
+	w.Header().Set("Grpc-Message", grpcMessage(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcMessage percent-encodes the message as the grpc-message header requires.
+func grpcMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func isGRPCRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// serveUnavailable responds with a 503 page for a route without any upstream
+// that may receive requests, telling a service that is still starting apart
+// from one that is down.
+func serveUnavailable(w http.ResponseWriter, r *http.Request, route *Route, host string) {
+	for _, upstream := range route.Upstreams {
+		if upstream.Starting() {
+			w.Header().Set("Retry-After", startingRetryAfter)
+			serveErrorPage(w, r, http.StatusServiceUnavailable, "Service Starting",
+				host+" is starting up, please try again in a few seconds.")
+			return
+		}
+	}
+	serveErrorPage(w, r, http.StatusServiceUnavailable, "Service Unavailable",
+		"No healthy instance of "+host+" is available.")
+}
+
+// serveBadGateway responds with a 502 page when the upstream could not be
+// reached or failed before sending a response.
+func serveBadGateway(w http.ResponseWriter, r *http.Request, upstream *Upstream) {
+	serveErrorPage(w, r, http.StatusBadGateway, "Bad Gateway",
+		fmt.Sprintf("%s did not respond to the request for %s.", upstreamName(upstream), r.Host))
+}
+
+// serveGatewayTimeout responds with a 504 page when the upstream did not
+// answer within its timeouts.
+func serveGatewayTimeout(w http.ResponseWriter, r *http.Request, upstream *Upstream) {
+	serveErrorPage(w, r, http.StatusGatewayTimeout, "Gateway Timeout",
+		fmt.Sprintf("%s did not respond in time to the request for %s.", upstreamName(upstream), r.Host))
+}
+
+func upstreamName(upstream *Upstream) string {
+	if upstream.ContainerName != "" {
+		return upstream.ContainerName
+	}
+	return upstream.Target.Host
+}
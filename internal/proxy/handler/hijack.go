@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// hijackTracker keeps track of connections taken over from the HTTP server,
+// such as WebSocket upgrades, which http.Server.Shutdown neither waits for nor
+// closes.
+type hijackTracker struct {
+	conns map[*trackedConn]struct{}
+	lock  sync.Mutex
+}
+
+func newHijackTracker() *hijackTracker {
+	return &hijackTracker{conns: make(map[*trackedConn]struct{})}
+}
+
+func (t *hijackTracker) track(conn net.Conn) *trackedConn {
+	tracked := &trackedConn{Conn: conn, tracker: t}
+	t.lock.Lock()
+	t.conns[tracked] = struct{}{}
+	t.lock.Unlock()
+	return tracked
+}
+
+func (t *hijackTracker) untrack(conn *trackedConn) {
+	t.lock.Lock()
+	delete(t.conns, conn)
+	t.lock.Unlock()
+}
+
+func (t *hijackTracker) count() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.conns)
+}
+
+func (t *hijackTracker) closeAll() int {
+	t.lock.Lock()
+	conns := make([]*trackedConn, 0, len(t.conns))
+	for conn := range t.conns {
+		conns = append(conns, conn)
+	}
+	t.lock.Unlock()
+
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	return len(conns)
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker   *hijackTracker
+	closeOnce sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.tracker.untrack(c)
+	})
+	return err
+}
+
+// hijackTrackingWriter registers the connection with the tracker when the
+// reverse proxy hijacks it to serve a protocol upgrade.
+type hijackTrackingWriter struct {
+	http.ResponseWriter
+	tracker *hijackTracker
+}
+
+func (w *hijackTrackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return w.tracker.track(conn), rw, nil
+}
+
+func (w *hijackTrackingWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *hijackTrackingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func isUpgradeRequest(r *http.Request) bool {
+	for _, value := range r.Header["Connection"] {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// newUpgradeBackend returns a backend that switches protocols and then echoes
+// every line it receives.
+func newUpgradeBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isUpgradeRequest(r) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		_ = rw.Flush()
+		for {
+			line, err := rw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			_, _ = rw.WriteString(line)
+			_ = rw.Flush()
+		}
+	}))
+}
+
+func dialUpgrade(t *testing.T, addr, host string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: " + host + "\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to write upgrade request: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read upgrade response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade status code = %v, want %v", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	return conn, reader
+}
+
+func TestProxyHandler_CloseHijackedConns(t *testing.T) {
+	backend := newUpgradeBackend(t)
+	defer backend.Close()
+
+	h := NewProxyHandler(zerolog.Nop())
+	if err := h.AddRoute(Route{Host: "ws.localhost", Upstreams: createTestUpstreams(t, backend.URL)}); err != nil {
+		t.Fatalf("AddRoute() error = %v", err)
+	}
+	proxy := httptest.NewServer(h)
+	defer proxy.Close()
+
+	conn, reader := dialUpgrade(t, proxy.Listener.Addr().String(), "ws.localhost")
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatalf("Failed to write to upgraded connection: %v", err)
+	}
+	if line, err := reader.ReadString('\n'); err != nil || line != "ping\n" {
+		t.Fatalf("echo = %q, %v, want ping", line, err)
+	}
+
+	if count := h.hijacked.count(); count != 1 {
+		t.Fatalf("tracked connections = %d, want 1", count)
+	}
+
+	if closed := h.CloseHijackedConns(); closed != 1 {
+		t.Errorf("CloseHijackedConns() = %d, want 1", closed)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Error("read after close succeeded, want connection closed")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for h.hijacked.count() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := h.hijacked.count(); count != 0 {
+		t.Errorf("tracked connections after close = %d, want 0", count)
+	}
+}
+
+func TestIsUpgradeRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection []string
+		want       bool
+	}{
+		{name: "Success: Upgrade token", connection: []string{"Upgrade"}, want: true},
+		{name: "Success: Upgrade among other tokens", connection: []string{"keep-alive, upgrade"}, want: true},
+		{name: "Error: No upgrade token", connection: []string{"keep-alive"}, want: false},
+		{name: "Error: No Connection header", connection: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			if tt.connection != nil {
+				req.Header["Connection"] = tt.connection
+			}
+			if got := isUpgradeRequest(req); got != tt.want {
+				t.Errorf("isUpgradeRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RegexpHostPrefix marks a route host as a regular expression. The expression
+// must match the whole request host.
+const RegexpHostPrefix = "~"
+
+// hostPattern matches request hosts against a wildcard ("*.app.localhost") or
+// regular expression ("~^[a-z]+\.app\.localhost$") route host.
+type hostPattern struct {
+	host   string
+	suffix string // Set for wildcards, e.g. ".app.localhost"
+	regexp *regexp.Regexp
+}
+
+// newHostPattern parses a route host. It returns nil for plain hosts, which
+// are matched exactly.
+func newHostPattern(host string) (*hostPattern, error) {
+	switch {
+	case strings.HasPrefix(host, RegexpHostPrefix):
+		re, err := regexp.Compile("^(?:" + strings.TrimPrefix(host, RegexpHostPrefix) + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid host regexp %q: %w", host, err)
+		}
+		return &hostPattern{host: host, regexp: re}, nil
+	case strings.HasPrefix(host, "*.") && !strings.Contains(host[1:], "*"):
+		return &hostPattern{host: host, suffix: host[1:]}, nil
+	case strings.Contains(host, "*"):
+		return nil, fmt.Errorf("invalid wildcard host %q: only a leading \"*.\" is supported", host)
+	}
+	return nil, nil
+}
+
+// matches reports whether the request host is covered by the pattern. A
+// wildcard matches one or more labels in front of its suffix.
+func (p *hostPattern) matches(host string) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(host)
+	}
+	return len(host) > len(p.suffix) && strings.HasSuffix(host, p.suffix)
+}
+
+// sortHostPatterns orders patterns from most to least specific: wildcards
+// before regular expressions, and longer wildcard suffixes first.
+func sortHostPatterns(patterns []*hostPattern) {
+	sort.SliceStable(patterns, func(i, j int) bool {
+		a, b := patterns[i], patterns[j]
+		if (a.regexp == nil) != (b.regexp == nil) {
+			return a.regexp == nil
+		}
+		if len(a.suffix) != len(b.suffix) {
+			return len(a.suffix) > len(b.suffix)
+		}
+		return a.host < b.host
+	})
+}
@@ -1,50 +1,339 @@
 package handler
 
 import (
+	"context"
 	"net"
 	"net/http"
-	"net/http/httputil"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog"
 )
 
 type ProxyHandler struct {
-	routes     map[string]*httputil.ReverseProxy
+	// routes holds the routes of each host ordered by descending path length,
+	// so the first matching entry is always the longest prefix
+	routes map[string][]*Route
+	// patterns holds the wildcard and regexp hosts of routes, most specific first
+	patterns   []*hostPattern
 	routesLock sync.RWMutex
+	// httpsPort is the port HTTP requests are redirected to, empty when HTTPS is disabled
+	httpsPort string
+	// retryDelay is the pause before a failed request is retried on another replica
+	retryDelay time.Duration
+	hijacked   *hijackTracker
 	logger     zerolog.Logger
 }
 
 func NewProxyHandler(logger zerolog.Logger) *ProxyHandler {
 	return &ProxyHandler{
-		routes: make(map[string]*httputil.ReverseProxy),
-		logger: logger,
+		routes:   make(map[string][]*Route),
+		hijacked: newHijackTracker(),
+		logger:   logger,
 	}
 }
 
-func (h *ProxyHandler) AddRoute(host string, proxy *httputil.ReverseProxy) {
+// CloseHijackedConns closes all upgraded connections, such as WebSockets, that
+// are still open and returns how many were closed.
+func (h *ProxyHandler) CloseHijackedConns() int {
+	return h.hijacked.closeAll()
+}
+
+func (h *ProxyHandler) SetHTTPSPort(port string) {
 	h.routesLock.Lock()
 	defer h.routesLock.Unlock()
-	h.routes[host] = proxy
+	h.httpsPort = port
 }
 
-func (h *ProxyHandler) RemoveRoute(host string) {
+func (h *ProxyHandler) SetRetryDelay(delay time.Duration) {
 	h.routesLock.Lock()
 	defer h.routesLock.Unlock()
-	delete(h.routes, host)
+	h.retryDelay = delay
 }
 
-func (h *ProxyHandler) GetRoutes() []string {
+// HasHost reports whether a request for the host can match a route, either
+// exactly or through a wildcard or regexp host.
+func (h *ProxyHandler) HasHost(host string) bool {
 	h.routesLock.RLock()
 	defer h.routesLock.RUnlock()
-	routes := make([]string, 0, len(h.routes))
-	for route := range h.routes {
-		routes = append(routes, route)
+	return len(h.hostRoutes(host)) > 0
+}
+
+func (h *ProxyHandler) HasUpstream(host, path, upstreamID string) bool {
+	path = NormalizePath(path)
+
+	h.routesLock.RLock()
+	defer h.routesLock.RUnlock()
+
+	route := h.getRoute(host, path)
+	if route == nil {
+		return false
+	}
+	for _, upstream := range route.Upstreams {
+		if upstream.ID == upstreamID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *ProxyHandler) AddRoute(route Route) error {
+	balancer, err := NewBalancer(route.LoadBalancer)
+	if err != nil {
+		return err
+	}
+	pattern, err := newHostPattern(route.Host)
+	if err != nil {
+		return err
 	}
+	route.pattern = pattern
+	route.Path = NormalizePath(route.Path)
+	route.Upstreams = append([]*Upstream(nil), route.Upstreams...)
+	route.balancer = balancer
+	route.upgrades = new(int64)
+
+	h.routesLock.Lock()
+	defer h.routesLock.Unlock()
+	h.setRoute(&route)
+	return nil
+}
+
+// AddUpstream adds the upstream to the pool of the route matching the host and
+// path of the given route, creating the route if it does not exist yet. An
+// upstream with the same ID already in the pool is replaced.
+func (h *ProxyHandler) AddUpstream(route Route, upstream *Upstream) error {
+	route.Path = NormalizePath(route.Path)
+	pattern, err := newHostPattern(route.Host)
+	if err != nil {
+		return err
+	}
+	route.pattern = pattern
+
+	h.routesLock.Lock()
+	defer h.routesLock.Unlock()
+
+	existing := h.getRoute(route.Host, route.Path)
+	if existing != nil {
+		route.Disabled = existing.Disabled
+		route.upgrades = existing.upgrades
+	} else {
+		route.upgrades = new(int64)
+	}
+	if existing == nil || existing.LoadBalancer != route.LoadBalancer {
+		balancer, err := NewBalancer(route.LoadBalancer)
+		if err != nil {
+			return err
+		}
+		route.balancer = balancer
+	} else {
+		route.balancer = existing.balancer
+	}
+
+	route.Upstreams = []*Upstream{upstream}
+	if existing != nil {
+		route.Upstreams = make([]*Upstream, 0, len(existing.Upstreams)+1)
+		for _, u := range existing.Upstreams {
+			if u.ID != upstream.ID {
+				route.Upstreams = append(route.Upstreams, u)
+			}
+		}
+		route.Upstreams = append(route.Upstreams, upstream)
+	}
+
+	h.setRoute(&route)
+	return nil
+}
+
+// RemoveUpstream removes the upstream from the pool of the route and drops
+// the route once its pool is empty.
+func (h *ProxyHandler) RemoveUpstream(host, path, upstreamID string) {
+	path = NormalizePath(path)
+
+	h.routesLock.Lock()
+	defer h.routesLock.Unlock()
+
+	existing := h.getRoute(host, path)
+	if existing == nil {
+		return
+	}
+
+	route := *existing
+	route.Upstreams = make([]*Upstream, 0, len(existing.Upstreams))
+	for _, u := range existing.Upstreams {
+		if u.ID != upstreamID {
+			route.Upstreams = append(route.Upstreams, u)
+		}
+	}
+
+	if len(route.Upstreams) == 0 {
+		h.deleteRoute(host, path)
+		return
+	}
+	h.setRoute(&route)
+}
+
+func (h *ProxyHandler) RemoveRoute(host, path string) bool {
+	path = NormalizePath(path)
+
+	h.routesLock.Lock()
+	defer h.routesLock.Unlock()
+
+	if h.getRoute(host, path) == nil {
+		return false
+	}
+	h.deleteRoute(host, path)
+	return true
+}
+
+// SetRouteDisabled toggles whether the route takes part in request matching.
+// A disabled route stays in the table and keeps its upstreams.
+func (h *ProxyHandler) SetRouteDisabled(host, path string, disabled bool) bool {
+	path = NormalizePath(path)
+
+	h.routesLock.Lock()
+	defer h.routesLock.Unlock()
+
+	existing := h.getRoute(host, path)
+	if existing == nil {
+		return false
+	}
+
+	route := *existing
+	route.Disabled = disabled
+	h.setRoute(&route)
+	return true
+}
+
+func (h *ProxyHandler) GetRoutes() []Route {
+	h.routesLock.RLock()
+	defer h.routesLock.RUnlock()
+
+	routes := make([]Route, 0, len(h.routes))
+	for _, hostRoutes := range h.routes {
+		for _, route := range hostRoutes {
+			routes = append(routes, *route)
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		return len(routes[i].Path) > len(routes[j].Path)
+	})
 	return routes
 }
 
+// getRoute, setRoute and deleteRoute must be called with routesLock held.
+// Routes are never modified in place once stored so that copies handed out
+// by GetRoutes stay consistent.
+func (h *ProxyHandler) getRoute(host, path string) *Route {
+	for _, route := range h.routes[host] {
+		if route.Path == path {
+			return route
+		}
+	}
+	return nil
+}
+
+func (h *ProxyHandler) setRoute(route *Route) {
+	hostRoutes := h.routes[route.Host]
+	for i, existing := range hostRoutes {
+		if existing.Path == route.Path {
+			hostRoutes[i] = route
+			return
+		}
+	}
+
+	if len(hostRoutes) == 0 && route.pattern != nil {
+		h.patterns = append(h.patterns, route.pattern)
+		sortHostPatterns(h.patterns)
+	}
+
+	hostRoutes = append(hostRoutes, route)
+	sort.SliceStable(hostRoutes, func(i, j int) bool {
+		if len(hostRoutes[i].Path) != len(hostRoutes[j].Path) {
+			return len(hostRoutes[i].Path) > len(hostRoutes[j].Path)
+		}
+		return hostRoutes[i].Path < hostRoutes[j].Path
+	})
+	h.routes[route.Host] = hostRoutes
+}
+
+func (h *ProxyHandler) deleteRoute(host, path string) {
+	hostRoutes := h.routes[host]
+	for i, existing := range hostRoutes {
+		if existing.Path != path {
+			continue
+		}
+		hostRoutes = append(hostRoutes[:i:i], hostRoutes[i+1:]...)
+		break
+	}
+
+	if len(hostRoutes) == 0 {
+		delete(h.routes, host)
+		h.deletePattern(host)
+		return
+	}
+	h.routes[host] = hostRoutes
+}
+
+func (h *ProxyHandler) deletePattern(host string) {
+	for i, pattern := range h.patterns {
+		if pattern.host == host {
+			h.patterns = append(h.patterns[:i:i], h.patterns[i+1:]...)
+			return
+		}
+	}
+}
+
+// hostRoutes returns the route lists whose host covers the request host, in
+// order of specificity: the exact host first, then wildcards with the longest
+// suffix, then regexps. It must be called with routesLock held.
+func (h *ProxyHandler) hostRoutes(host string) [][]*Route {
+	var candidates [][]*Route
+	if routes, ok := h.routes[host]; ok && routes[0].pattern == nil {
+		candidates = append(candidates, routes)
+	}
+	for _, pattern := range h.patterns {
+		if pattern.matches(host) {
+			candidates = append(candidates, h.routes[pattern.host])
+		}
+	}
+	return candidates
+}
+
+func (h *ProxyHandler) redirectURL(r *http.Request, host string) string {
+	h.routesLock.RLock()
+	port := h.httpsPort
+	h.routesLock.RUnlock()
+
+	if port == "" {
+		return ""
+	}
+	if port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	return "https://" + host + r.URL.RequestURI()
+}
+
+func (h *ProxyHandler) findRoute(host, path string) (*Route, *Upstream, bool) {
+	h.routesLock.RLock()
+	defer h.routesLock.RUnlock()
+
+	for _, routes := range h.hostRoutes(host) {
+		for _, route := range routes {
+			if !route.Disabled && route.matches(path) {
+				return route, route.balancer.Next(availableUpstreams(route.Upstreams)), true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
 func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	host := strings.Split(r.Host, ":")[0]
 
@@ -55,18 +344,30 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Str("remote_addr", r.RemoteAddr).
 		Msg("Request received")
 
-	h.routesLock.RLock()
-	proxy, exists := h.routes[host]
-	h.routesLock.RUnlock()
-
+	route, upstream, exists := h.findRoute(host, r.URL.Path)
 	if !exists {
 		h.logger.Debug().
 			Str("host", host).
+			Str("path", r.URL.Path).
 			Msg("Route not found")
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
+	if route.RedirectHTTPS && r.TLS == nil {
+		if location := h.redirectURL(r, host); location != "" {
+			http.Redirect(w, r, location, http.StatusPermanentRedirect)
+			return
+		}
+	}
 
+	if upstream == nil {
+		h.logger.Debug().
+			Str("host", host).
+			Str("path", route.Path).
+			Msg("No upstream available")
+		serveUnavailable(w, r, route, host)
+		return
+	}
 	// Set X-Forwarded-* headers
 	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
 		if prior, ok := r.Header["X-Forwarded-For"]; ok {
@@ -75,7 +376,64 @@ func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r.Header.Set("X-Forwarded-For", clientIP)
 	}
 	r.Header.Set("X-Forwarded-Host", r.Host)
-	r.Header.Set("X-Forwarded-Proto", "http")
+	if r.TLS != nil {
+		r.Header.Set("X-Forwarded-Proto", "https")
+	} else {
+		r.Header.Set("X-Forwarded-Proto", "http")
+	}
 
-	proxy.ServeHTTP(w, r)
+	if route.StripPrefix && route.Path != "/" {
+		r.Header.Set("X-Forwarded-Prefix", route.Path)
+		r.URL.Path = route.strip(r.URL.Path)
+		if strings.HasPrefix(r.URL.RawPath, route.Path) {
+			r.URL.RawPath = route.strip(r.URL.RawPath)
+		} else {
+			r.URL.RawPath = ""
+		}
+	}
+
+	if isUpgradeRequest(r) {
+		h.serveUpgrade(w, r, route, host, upstream)
+		return
+	}
+
+	h.forward(&eventStreamWriter{ResponseWriter: w}, r, route, host, upstream)
+}
+
+// serveUpstream proxies the request to the upstream unless its circuit
+// rejects it, and reports whether the request was sent.
+func (h *ProxyHandler) serveUpstream(w http.ResponseWriter, r *http.Request, upstream *Upstream) bool {
+	circuit := upstream.CircuitState()
+	if !upstream.breaker.allow() {
+		// Another request is already the trial request of the half-open circuit
+		return false
+	}
+
+	atomic.AddInt64(&upstream.activeRequests, 1)
+	defer atomic.AddInt64(&upstream.activeRequests, -1)
+
+	if upstream.requestTimeout > 0 && !isUpgradeRequest(r) {
+		ctx, cancel := context.WithTimeout(r.Context(), upstream.requestTimeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	upstream.Proxy.ServeHTTP(w, r)
+
+	if state := upstream.CircuitState(); state != circuit {
+		h.logCircuitChange(upstream, circuit, state)
+	}
+	return true
+}
+
+func (h *ProxyHandler) logCircuitChange(upstream *Upstream, from, to CircuitState) {
+	event := h.logger.Info()
+	if to == CircuitOpen {
+		event = h.logger.Warn()
+	}
+	event.
+		Str("upstream_id", upstream.ID).
+		Str("target", upstream.Target.String()).
+		Str("from", from.String()).
+		Str("to", to.String()).
+		Msg("Upstream circuit changed")
 }
@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"net/http/httputil"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/rs/zerolog"
@@ -27,31 +29,39 @@ func TestProxyHandler_ServeHTTP(t *testing.T) {
 	tests := []struct {
 		name           string
 		host           string
-		setupRoutes    map[string]*httputil.ReverseProxy
+		setupRoutes    []Route
 		wantStatusCode int
 	}{
 		{
 			name: "Success: Request to registered host",
 			host: "example.com",
-			setupRoutes: map[string]*httputil.ReverseProxy{
-				"example.com": createTestProxy(t, backend.URL),
+			setupRoutes: []Route{
+				{Host: "example.com", Upstreams: createTestUpstreams(t, backend.URL)},
 			},
 			wantStatusCode: http.StatusOK,
 		},
 		{
 			name:           "Error: Request to unregistered host",
 			host:           "unknown.com",
-			setupRoutes:    map[string]*httputil.ReverseProxy{},
+			setupRoutes:    []Route{},
 			wantStatusCode: http.StatusNotFound,
 		},
 		{
 			name: "Success: Request to host with port number",
 			host: "example.com:8000",
-			setupRoutes: map[string]*httputil.ReverseProxy{
-				"example.com": createTestProxy(t, backend.URL),
+			setupRoutes: []Route{
+				{Host: "example.com", Upstreams: createTestUpstreams(t, backend.URL)},
 			},
 			wantStatusCode: http.StatusOK,
 		},
+		{
+			name: "Error: Request outside registered path",
+			host: "example.com",
+			setupRoutes: []Route{
+				{Host: "example.com", Path: "/api", Upstreams: createTestUpstreams(t, backend.URL)},
+			},
+			wantStatusCode: http.StatusNotFound,
+		},
 	}
 
 	for _, tt := range tests {
@@ -60,8 +70,10 @@ func TestProxyHandler_ServeHTTP(t *testing.T) {
 			h := NewProxyHandler(zerolog.Nop())
 
 			// Set up routes
-			for host, proxy := range tt.setupRoutes {
-				h.AddRoute(host, proxy)
+			for _, route := range tt.setupRoutes {
+				if err := h.AddRoute(route); err != nil {
+					t.Fatalf("AddRoute() error = %v", err)
+				}
 			}
 
 			// Create test request
@@ -88,28 +100,483 @@ func TestProxyHandler_RouteManagement(t *testing.T) {
 	}))
 	defer backend.Close()
 
-	proxy := createTestProxy(t, backend.URL)
+	upstreams := createTestUpstreams(t, backend.URL, backend.URL)
 
-	h.AddRoute("example.com", proxy)
+	for _, upstream := range upstreams {
+		if err := h.AddUpstream(Route{Host: "example.com"}, upstream); err != nil {
+			t.Fatalf("AddUpstream() error = %v", err)
+		}
+	}
+	// Re-adding an upstream replaces it instead of growing the pool
+	if err := h.AddUpstream(Route{Host: "example.com"}, upstreams[0]); err != nil {
+		t.Fatalf("AddUpstream() error = %v", err)
+	}
 
 	routes := h.GetRoutes()
-	if len(routes) != 1 || routes[0] != "example.com" {
-		t.Errorf("GetRoutes() = %v, want [example.com]", routes)
+	if len(routes) != 1 || routes[0].Host != "example.com" || routes[0].Path != "/" {
+		t.Errorf("GetRoutes() = %v, want [example.com/]", routes)
+	}
+	if len(routes[0].Upstreams) != 2 {
+		t.Errorf("GetRoutes() upstreams = %d, want 2", len(routes[0].Upstreams))
 	}
 
-	h.RemoveRoute("example.com")
+	h.RemoveUpstream("example.com", "/", upstreams[0].ID)
+	routes = h.GetRoutes()
+	if len(routes) != 1 || len(routes[0].Upstreams) != 1 || routes[0].Upstreams[0].ID != upstreams[1].ID {
+		t.Errorf("GetRoutes() after upstream removal = %v, want single upstream %s", routes, upstreams[1].ID)
+	}
 
+	h.RemoveUpstream("example.com", "/", upstreams[1].ID)
 	routes = h.GetRoutes()
 	if len(routes) != 0 {
 		t.Errorf("GetRoutes() after removal = %v, want []", routes)
 	}
+
+	if err := h.AddUpstream(Route{Host: "example.com", LoadBalancer: "random"}, upstreams[0]); err == nil {
+		t.Error("AddUpstream() with unknown load balancer error = nil, want error")
+	}
+
+	if h.RemoveRoute("example.com", "/") {
+		t.Error("RemoveRoute() of missing route = true, want false")
+	}
+	if h.SetRouteDisabled("example.com", "/", true) {
+		t.Error("SetRouteDisabled() of missing route = true, want false")
+	}
+}
+
+func TestProxyHandler_DisabledRoute(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	h := NewProxyHandler(zerolog.Nop())
+	upstreams := createTestUpstreams(t, backend.URL, backend.URL)
+	if err := h.AddUpstream(Route{Host: "example.com"}, upstreams[0]); err != nil {
+		t.Fatalf("AddUpstream() error = %v", err)
+	}
+
+	serve := func() int {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if !h.SetRouteDisabled("example.com", "/", true) {
+		t.Fatal("SetRouteDisabled() = false, want true")
+	}
+	if code := serve(); code != http.StatusNotFound {
+		t.Errorf("ServeHTTP() on disabled route status code = %v, want %v", code, http.StatusNotFound)
+	}
+
+	// Replicas joining a disabled route do not re-enable it
+	if err := h.AddUpstream(Route{Host: "example.com"}, upstreams[1]); err != nil {
+		t.Fatalf("AddUpstream() error = %v", err)
+	}
+	if routes := h.GetRoutes(); len(routes) != 1 || !routes[0].Disabled {
+		t.Errorf("GetRoutes() = %v, want a single disabled route", routes)
+	}
+
+	h.SetRouteDisabled("example.com", "/", false)
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("ServeHTTP() on re-enabled route status code = %v, want %v", code, http.StatusOK)
+	}
+}
+
+func TestProxyHandler_LoadBalancing(t *testing.T) {
+	hits := make(map[string]int)
+	var hitsLock sync.Mutex
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			hitsLock.Lock()
+			hits[name]++
+			hitsLock.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	backend1 := newBackend("replica1")
+	defer backend1.Close()
+	backend2 := newBackend("replica2")
+	defer backend2.Close()
+	backend3 := newBackend("replica3")
+	defer backend3.Close()
+
+	h := NewProxyHandler(zerolog.Nop())
+	for _, upstream := range createTestUpstreams(t, backend1.URL, backend2.URL, backend3.URL) {
+		if err := h.AddUpstream(Route{Host: "api.localhost"}, upstream); err != nil {
+			t.Fatalf("AddUpstream() error = %v", err)
+		}
+	}
+
+	for i := 0; i < 9; i++ {
+		req := httptest.NewRequest("GET", "http://api.localhost/", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("ServeHTTP() status code = %v, want %v", w.Code, http.StatusOK)
+		}
+	}
+
+	for _, name := range []string{"replica1", "replica2", "replica3"} {
+		if hits[name] != 3 {
+			t.Errorf("requests to %s = %d, want 3 (hits: %v)", name, hits[name], hits)
+		}
+	}
+}
+
+func TestProxyHandler_PathRouting(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Backend", name)
+			w.Header().Set("X-Path", r.URL.Path)
+			w.Header().Set("X-Prefix", r.Header.Get("X-Forwarded-Prefix"))
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	root := newBackend("root")
+	defer root.Close()
+	api := newBackend("api")
+	defer api.Close()
+	apiV2 := newBackend("api-v2")
+	defer apiV2.Close()
+
+	h := NewProxyHandler(zerolog.Nop())
+	for _, route := range []Route{
+		{Host: "app.localhost", Path: "/", Upstreams: createTestUpstreams(t, root.URL)},
+		{Host: "app.localhost", Path: "/api/", Upstreams: createTestUpstreams(t, api.URL)},
+		{Host: "app.localhost", Path: "/api/v2", StripPrefix: true, Upstreams: createTestUpstreams(t, apiV2.URL)},
+	} {
+		if err := h.AddRoute(route); err != nil {
+			t.Fatalf("AddRoute() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		wantBackend string
+		wantPath    string
+		wantPrefix  string
+	}{
+		{
+			name:        "Success: Root path goes to root route",
+			path:        "/",
+			wantBackend: "root",
+			wantPath:    "/",
+		},
+		{
+			name:        "Success: Exact prefix match",
+			path:        "/api",
+			wantBackend: "api",
+			wantPath:    "/api",
+		},
+		{
+			name:        "Success: Prefix match keeps path",
+			path:        "/api/users",
+			wantBackend: "api",
+			wantPath:    "/api/users",
+		},
+		{
+			name:        "Success: Prefix only matches whole segments",
+			path:        "/apiary",
+			wantBackend: "root",
+			wantPath:    "/apiary",
+		},
+		{
+			name:        "Success: Longest prefix wins and is stripped",
+			path:        "/api/v2/users",
+			wantBackend: "api-v2",
+			wantPath:    "/users",
+			wantPrefix:  "/api/v2",
+		},
+		{
+			name:        "Success: Stripping exact prefix leaves root path",
+			path:        "/api/v2",
+			wantBackend: "api-v2",
+			wantPath:    "/",
+			wantPrefix:  "/api/v2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://app.localhost"+tt.path, nil)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if got := w.Header().Get("X-Backend"); got != tt.wantBackend {
+				t.Errorf("ServeHTTP() backend = %v, want %v", got, tt.wantBackend)
+			}
+			if got := w.Header().Get("X-Path"); got != tt.wantPath {
+				t.Errorf("ServeHTTP() upstream path = %v, want %v", got, tt.wantPath)
+			}
+			if got := w.Header().Get("X-Prefix"); got != tt.wantPrefix {
+				t.Errorf("ServeHTTP() X-Forwarded-Prefix = %v, want %v", got, tt.wantPrefix)
+			}
+		})
+	}
+
+	h.RemoveRoute("app.localhost", "/api/v2/")
+	routes := h.GetRoutes()
+	if len(routes) != 2 || routes[0].Path != "/api" || routes[1].Path != "/" {
+		t.Errorf("GetRoutes() after removal = %v, want [/api /]", routes)
+	}
+}
+
+func TestProxyHandler_HostMatching(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("X-Backend", name)
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	exact := newBackend("exact")
+	defer exact.Close()
+	wildcard := newBackend("wildcard")
+	defer wildcard.Close()
+	nested := newBackend("nested")
+	defer nested.Close()
+	regexp := newBackend("regexp")
+	defer regexp.Close()
+
+	h := NewProxyHandler(zerolog.Nop())
+	for _, route := range []Route{
+		{Host: "admin.app.localhost", Path: "/admin", Upstreams: createTestUpstreams(t, exact.URL)},
+		{Host: "*.app.localhost", Upstreams: createTestUpstreams(t, wildcard.URL)},
+		{Host: "*.eu.app.localhost", Upstreams: createTestUpstreams(t, nested.URL)},
+		{Host: `~tenant-[0-9]+\.localhost`, Upstreams: createTestUpstreams(t, regexp.URL)},
+	} {
+		if err := h.AddRoute(route); err != nil {
+			t.Fatalf("AddRoute() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		host        string
+		path        string
+		wantBackend string
+		wantStatus  int
+	}{
+		{name: "Success: Exact host wins over wildcard", host: "admin.app.localhost", path: "/admin", wantBackend: "exact", wantStatus: http.StatusOK},
+		{name: "Success: Wildcard covers paths the exact host lacks", host: "admin.app.localhost", path: "/", wantBackend: "wildcard", wantStatus: http.StatusOK},
+		{name: "Success: Wildcard matches a subdomain", host: "acme.app.localhost", path: "/", wantBackend: "wildcard", wantStatus: http.StatusOK},
+		{name: "Success: Longer wildcard suffix wins", host: "acme.eu.app.localhost", path: "/", wantBackend: "nested", wantStatus: http.StatusOK},
+		{name: "Success: Regexp matches the whole host", host: "tenant-42.localhost", path: "/", wantBackend: "regexp", wantStatus: http.StatusOK},
+		{name: "Error: Wildcard does not match its bare suffix", host: "app.localhost", path: "/", wantStatus: http.StatusNotFound},
+		{name: "Error: Regexp is anchored", host: "x.tenant-42.localhost.example", path: "/", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://"+tt.host+tt.path, nil)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("ServeHTTP() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("X-Backend"); got != tt.wantBackend {
+				t.Errorf("ServeHTTP() backend = %v, want %v", got, tt.wantBackend)
+			}
+			if got := h.HasHost(tt.host); got != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("HasHost() = %v, want %v", got, !got)
+			}
+		})
+	}
+
+	h.RemoveRoute("*.eu.app.localhost", "/")
+	if !h.HasHost("acme.eu.app.localhost") || len(h.patterns) != 2 {
+		t.Errorf("after removal HasHost() = %v, patterns = %d, want true, 2", h.HasHost("acme.eu.app.localhost"), len(h.patterns))
+	}
+
+	if err := h.AddRoute(Route{Host: "~[", Upstreams: createTestUpstreams(t, exact.URL)}); err == nil {
+		t.Error("AddRoute() with invalid regexp succeeded, want error")
+	}
+	if err := h.AddRoute(Route{Host: "app.*.localhost", Upstreams: createTestUpstreams(t, exact.URL)}); err == nil {
+		t.Error("AddRoute() with inner wildcard succeeded, want error")
+	}
 }
 
-func createTestProxy(t *testing.T, targetURL string) *httputil.ReverseProxy {
+func TestProxyHandler_Health(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		name           string
+		health         []HealthStatus
+		wantStatus     int
+		wantBody       string
+		wantRetryAfter string
+	}{
+		{
+			name:       "Success: Upstreams without health check are routed",
+			health:     []HealthStatus{HealthNone},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Success: Healthy replica is used while another is starting",
+			health:     []HealthStatus{HealthStarting, HealthHealthy},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:           "Error: Starting upstream serves the starting page",
+			health:         []HealthStatus{HealthStarting, HealthUnhealthy},
+			wantStatus:     http.StatusServiceUnavailable,
+			wantBody:       "Service Starting",
+			wantRetryAfter: "5",
+		},
+		{
+			name:       "Error: Unhealthy upstream is not routed",
+			health:     []HealthStatus{HealthUnhealthy},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "Service Unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urls := make([]string, len(tt.health))
+			for i := range urls {
+				urls[i] = backend.URL
+			}
+			upstreams := createTestUpstreams(t, urls...)
+			for i, health := range tt.health {
+				upstreams[i].SetHealth(health)
+			}
+
+			h := NewProxyHandler(zerolog.Nop())
+			if err := h.AddRoute(Route{Host: "app.localhost", Upstreams: upstreams}); err != nil {
+				t.Fatalf("AddRoute() error = %v", err)
+			}
+
+			for i := 0; i < 4; i++ {
+				req := httptest.NewRequest("GET", "http://app.localhost/", nil)
+				w := httptest.NewRecorder()
+
+				h.ServeHTTP(w, req)
+
+				if w.Code != tt.wantStatus {
+					t.Fatalf("ServeHTTP() status = %v, want %v", w.Code, tt.wantStatus)
+				}
+				if !strings.Contains(w.Body.String(), tt.wantBody) {
+					t.Errorf("ServeHTTP() body = %q, want it to contain %q", w.Body.String(), tt.wantBody)
+				}
+				if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+					t.Errorf("ServeHTTP() Retry-After = %q, want %q", got, tt.wantRetryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestProxyHandler_HTTPS(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Header.Get("X-Forwarded-Proto"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		name           string
+		httpsPort      string
+		redirect       bool
+		tls            bool
+		wantStatusCode int
+		wantLocation   string
+		wantProto      string
+	}{
+		{
+			name:           "Success: Plain request is forwarded as http",
+			httpsPort:      "443",
+			wantStatusCode: http.StatusOK,
+			wantProto:      "http",
+		},
+		{
+			name:           "Success: TLS request is forwarded as https",
+			httpsPort:      "443",
+			tls:            true,
+			wantStatusCode: http.StatusOK,
+			wantProto:      "https",
+		},
+		{
+			name:           "Success: Plain request is redirected to HTTPS",
+			httpsPort:      "443",
+			redirect:       true,
+			wantStatusCode: http.StatusPermanentRedirect,
+			wantLocation:   "https://app.localhost/path?q=1",
+		},
+		{
+			name:           "Success: Redirect keeps non-standard HTTPS port",
+			httpsPort:      "8443",
+			redirect:       true,
+			wantStatusCode: http.StatusPermanentRedirect,
+			wantLocation:   "https://app.localhost:8443/path?q=1",
+		},
+		{
+			name:           "Success: TLS request is not redirected",
+			httpsPort:      "443",
+			redirect:       true,
+			tls:            true,
+			wantStatusCode: http.StatusOK,
+			wantProto:      "https",
+		},
+		{
+			name:           "Success: Redirect is ignored while HTTPS is disabled",
+			redirect:       true,
+			wantStatusCode: http.StatusOK,
+			wantProto:      "http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewProxyHandler(zerolog.Nop())
+			h.SetHTTPSPort(tt.httpsPort)
+			if err := h.AddRoute(Route{
+				Host:          "app.localhost",
+				RedirectHTTPS: tt.redirect,
+				Upstreams:     createTestUpstreams(t, backend.URL),
+			}); err != nil {
+				t.Fatalf("AddRoute() error = %v", err)
+			}
+
+			target := "http://app.localhost/path?q=1"
+			if tt.tls {
+				target = "https://app.localhost/path?q=1"
+			}
+			req := httptest.NewRequest("GET", target, nil)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatusCode {
+				t.Errorf("ServeHTTP() status code = %v, want %v", w.Code, tt.wantStatusCode)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("ServeHTTP() Location = %v, want %v", got, tt.wantLocation)
+			}
+			if got := w.Header().Get("X-Proto"); got != tt.wantProto {
+				t.Errorf("ServeHTTP() X-Forwarded-Proto = %v, want %v", got, tt.wantProto)
+			}
+		})
+	}
+}
+
+func createTestUpstreams(t *testing.T, targetURLs ...string) []*Upstream {
 	t.Helper()
-	target, err := url.Parse(targetURL)
-	if err != nil {
-		t.Fatalf("Failed to parse target URL: %v", err)
+	upstreams := make([]*Upstream, 0, len(targetURLs))
+	for i, targetURL := range targetURLs {
+		target, err := url.Parse(targetURL)
+		if err != nil {
+			t.Fatalf("Failed to parse target URL: %v", err)
+		}
+		upstreams = append(upstreams, NewUpstream(fmt.Sprintf("upstream%d", i+1), target))
 	}
-	return httputil.NewSingleHostReverseProxy(target)
+	return upstreams
 }
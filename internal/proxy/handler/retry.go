@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxRetryBodySize is the largest request body buffered so that a request
+// with a body can be retried.
+const maxRetryBodySize = 64 << 10
+
+// errRetryableStatus makes the reverse proxy discard a response whose status
+// is retried on another replica.
+var errRetryableStatus = errors.New("retryable response status")
+
+type attemptKey struct{}
+
+// attempt is passed to the reverse proxy of an upstream through the request
+// context. Unless it is the final attempt, failures are recorded in it instead
+// of being written to the client so the request can be retried.
+type attempt struct {
+	final    bool
+	statuses []int
+	retry    bool
+}
+
+func attemptFromContext(ctx context.Context) *attempt {
+	a, _ := ctx.Value(attemptKey{}).(*attempt)
+	return a
+}
+
+// retryStatus reports whether a response with the status should be discarded
+// and the request retried.
+func (a *attempt) retryStatus(status int) bool {
+	if a == nil || a.final {
+		return false
+	}
+	for _, s := range a.statuses {
+		if s == status {
+			a.retry = true
+			return true
+		}
+	}
+	return false
+}
+
+// retryError reports whether a failed request should be retried instead of
+// answered with an error page. Requests that could not be sent because the
+// connection failed are always retried. Requests that timed out may already
+// have been processed, so only safe methods are retried after a timeout.
+func (a *attempt) retryError(r *http.Request, err error) bool {
+	if a == nil || a.final {
+		return false
+	}
+	if !isDialError(err) && !(isTimeout(err) && isSafeMethod(r.Method)) {
+		return false
+	}
+	a.retry = true
+	return true
+}
+
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// forward proxies the request to the upstream and, when it fails with a
+// retryable error or status, retries it on other replicas of the route. Only
+// requests without a body or with a small one are retried, and every replica
+// is tried at most once.
+func (h *ProxyHandler) forward(w http.ResponseWriter, r *http.Request, route *Route, host string, upstream *Upstream) {
+	var body []byte
+	retryable := route.RetryAttempts != 0
+	if retryable {
+		body, retryable = bufferBody(r)
+	}
+	if !retryable {
+		if !h.serveUpstream(w, r, upstream) {
+			serveUnavailable(w, r, route, host)
+		}
+		return
+	}
+
+	h.routesLock.RLock()
+	delay := h.retryDelay
+	h.routesLock.RUnlock()
+
+	tried := []*Upstream{upstream}
+	for retries := 0; ; retries++ {
+		a := &attempt{statuses: route.RetryStatuses}
+		a.final = (route.RetryAttempts > 0 && retries >= route.RetryAttempts) || len(untriedUpstreams(route, tried)) == 0
+		if body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if !h.serveUpstream(w, r.WithContext(context.WithValue(r.Context(), attemptKey{}, a)), upstream) {
+			if a.final {
+				// Nothing was written, as for a request that is not retried
+				serveUnavailable(w, r, route, host)
+				return
+			}
+			a.retry = true
+		}
+		if !a.retry {
+			return
+		}
+
+		h.logger.Debug().
+			Str("host", host).
+			Str("upstream_id", upstream.ID).
+			Int("retry", retries+1).
+			Msg("Retrying request on another replica")
+
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		candidates := untriedUpstreams(route, tried)
+		upstream = route.balancer.Next(candidates)
+		if upstream == nil {
+			// The remaining replicas became unavailable during the delay
+			serveUnavailable(w, r, route, host)
+			return
+		}
+		tried = append(tried, upstream)
+	}
+}
+
+// untriedUpstreams returns the available upstreams of the route that have not
+// been tried yet.
+func untriedUpstreams(route *Route, tried []*Upstream) []*Upstream {
+	var candidates []*Upstream
+	for _, upstream := range availableUpstreams(route.Upstreams) {
+		if !containsUpstream(tried, upstream) {
+			candidates = append(candidates, upstream)
+		}
+	}
+	return candidates
+}
+
+func containsUpstream(upstreams []*Upstream, upstream *Upstream) bool {
+	for _, u := range upstreams {
+		if u == upstream {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferBody reads the request body into memory so it can be sent again and
+// reports whether the request may be retried. Requests without a body, which
+// covers GET, HEAD and OPTIONS requests, are always retryable; requests with
+// a body only when its length is known and at most maxRetryBodySize bytes.
+// Bodies of unknown length may be streams, such as gRPC calls, whose client
+// waits for the response before sending the rest.
+func bufferBody(r *http.Request) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	if r.ContentLength < 0 || r.ContentLength > maxRetryBodySize {
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRetryBodySize+1))
+	if err != nil || len(body) > maxRetryBodySize {
+		// Hand the part already read back to the request so it is sent once
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil, false
+	}
+	return body, true
+}
@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestProxyHandler_Retry(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Backend", "healthy")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+	}))
+	defer healthy.Close()
+	overloaded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Backend", "overloaded")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer overloaded.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	tests := []struct {
+		name          string
+		backends      []string
+		retryAttempts int
+		retryStatuses []int
+		method        string
+		body          string
+		wantStatus    int
+	}{
+		{
+			name:          "Success: Connection error is retried on another replica",
+			backends:      []string{dead.URL, healthy.URL},
+			retryAttempts: 1,
+			method:        http.MethodGet,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "Success: Negative attempts try every replica",
+			backends:      []string{dead.URL, dead.URL, healthy.URL},
+			retryAttempts: -1,
+			method:        http.MethodGet,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "Success: Retryable status is retried",
+			backends:      []string{overloaded.URL, healthy.URL},
+			retryAttempts: 1,
+			retryStatuses: []int{http.StatusServiceUnavailable},
+			method:        http.MethodGet,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "Success: Small body is replayed",
+			backends:      []string{dead.URL, healthy.URL},
+			retryAttempts: 1,
+			method:        http.MethodPost,
+			body:          "payload",
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "Error: Status is passed through when it is not retryable",
+			backends:      []string{overloaded.URL, healthy.URL},
+			retryAttempts: 1,
+			method:        http.MethodGet,
+			wantStatus:    http.StatusServiceUnavailable,
+		},
+		{
+			name:          "Error: Retries are disabled",
+			backends:      []string{dead.URL, healthy.URL},
+			retryAttempts: 0,
+			method:        http.MethodGet,
+			wantStatus:    http.StatusBadGateway,
+		},
+		{
+			name:          "Error: Large body is not retried",
+			backends:      []string{dead.URL, healthy.URL},
+			retryAttempts: 1,
+			method:        http.MethodPost,
+			body:          strings.Repeat("x", maxRetryBodySize+1),
+			wantStatus:    http.StatusBadGateway,
+		},
+		{
+			name:          "Error: Last status is returned once every replica was tried",
+			backends:      []string{overloaded.URL, overloaded.URL},
+			retryAttempts: 3,
+			retryStatuses: []int{http.StatusServiceUnavailable},
+			method:        http.MethodGet,
+			wantStatus:    http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewProxyHandler(zerolog.Nop())
+			err := h.AddRoute(Route{
+				Host:          "app.localhost",
+				RetryAttempts: tt.retryAttempts,
+				RetryStatuses: tt.retryStatuses,
+				Upstreams:     createTestUpstreams(t, tt.backends...),
+			})
+			if err != nil {
+				t.Fatalf("AddRoute() error = %v", err)
+			}
+
+			// The first request goes to the first backend in round-robin order
+			req := httptest.NewRequest(tt.method, "http://app.localhost/", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("ServeHTTP() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != tt.body {
+				t.Errorf("ServeHTTP() echoed body length = %d, want %d", w.Body.Len(), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestProxyHandler_RetryRejectedByCircuit(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		name          string
+		retryAttempts int
+	}{
+		{
+			name:          "Error: Last attempt rejected by a half-open circuit",
+			retryAttempts: 3,
+		},
+		{
+			name:          "Error: Request rejected by a half-open circuit without retries",
+			retryAttempts: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewProxyHandler(zerolog.Nop())
+			upstreams := createTestUpstreams(t, backend.URL)
+			route := &Route{Host: "app.localhost", Path: "/", RetryAttempts: tt.retryAttempts, Upstreams: upstreams}
+			// Another request holds the trial slot of the half-open circuit
+			upstreams[0].breaker.state = CircuitHalfOpen
+
+			w := httptest.NewRecorder()
+			h.forward(w, httptest.NewRequest(http.MethodGet, "http://app.localhost/", nil), route, "app.localhost", upstreams[0])
+
+			if w.Code != http.StatusServiceUnavailable {
+				t.Errorf("forward() status = %v, want %v", w.Code, http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+func TestProxyHandler_RetryAfterSending(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+	hangUp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer hangUp.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	tests := []struct {
+		name       string
+		backend    string
+		method     string
+		wantStatus int
+	}{
+		{
+			name:       "Success: Connection refused is retried for any method",
+			backend:    dead.URL,
+			method:     http.MethodDelete,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Success: Timeout is retried for GET",
+			backend:    slow.URL,
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Success: Timeout is retried for OPTIONS",
+			backend:    slow.URL,
+			method:     http.MethodOptions,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Error: Timeout is not retried for POST",
+			backend:    slow.URL,
+			method:     http.MethodPost,
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "Error: Timeout is not retried for PATCH",
+			backend:    slow.URL,
+			method:     http.MethodPatch,
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "Error: Connection closed after sending is not retried",
+			backend:    hangUp.URL,
+			method:     http.MethodGet,
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewProxyHandler(zerolog.Nop())
+			upstreams := createTestUpstreams(t, tt.backend, healthy.URL)
+			for _, upstream := range upstreams {
+				upstream.SetTransport(ProtocolHTTP, nil, Timeouts{ResponseHeader: 50 * time.Millisecond})
+			}
+			err := h.AddRoute(Route{Host: "app.localhost", RetryAttempts: 1, Upstreams: upstreams})
+			if err != nil {
+				t.Fatalf("AddRoute() error = %v", err)
+			}
+
+			// The first request goes to the first backend in round-robin order
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tt.method, "http://app.localhost/", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("ServeHTTP() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
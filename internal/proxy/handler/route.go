@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+type Route struct {
+	Host          string
+	Path          string
+	StripPrefix   bool
+	RedirectHTTPS bool
+	LoadBalancer  string
+	Disabled      bool
+	// RetryAttempts is how many times a failed request is retried on another
+	// replica, negative to try every replica once
+	RetryAttempts int
+	// RetryStatuses are the response statuses retried like connection errors
+	RetryStatuses []int
+	// MaxUpgrades limits the concurrent upgraded connections, such as
+	// WebSockets, of the route; zero means no limit
+	MaxUpgrades int
+	Upstreams   []*Upstream
+
+	balancer Balancer
+	pattern  *hostPattern // Nil for exact hosts
+	upgrades *int64       // Open upgraded connections, shared by copies of the route
+}
+
+// ActiveUpgrades returns the number of open upgraded connections of the route.
+func (r *Route) ActiveUpgrades() int64 {
+	if r.upgrades == nil {
+		return 0
+	}
+	return atomic.LoadInt64(r.upgrades)
+}
+
+func (r *Route) acquireUpgrade() bool {
+	if r.upgrades == nil {
+		return true
+	}
+	if n := atomic.AddInt64(r.upgrades, 1); r.MaxUpgrades > 0 && n > int64(r.MaxUpgrades) {
+		atomic.AddInt64(r.upgrades, -1)
+		return false
+	}
+	return true
+}
+
+func (r *Route) releaseUpgrade() {
+	if r.upgrades != nil {
+		atomic.AddInt64(r.upgrades, -1)
+	}
+}
+
+// NormalizePath returns the canonical form of a route path prefix: it always
+// starts with "/" and has no trailing slash unless it is the root path.
+func NormalizePath(path string) string {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if len(path) > 1 {
+		path = strings.TrimRight(path, "/")
+		if path == "" {
+			path = "/"
+		}
+	}
+	return path
+}
+
+// matches reports whether the request path falls under the route prefix.
+// Matching is done on whole path segments, so "/api" matches "/api" and
+// "/api/users" but not "/apiv2".
+func (r *Route) matches(path string) bool {
+	if r.Path == "/" {
+		return true
+	}
+	if !strings.HasPrefix(path, r.Path) {
+		return false
+	}
+	return len(path) == len(r.Path) || path[len(r.Path)] == '/'
+}
+
+func (r *Route) strip(path string) string {
+	if r.Path == "/" {
+		return path
+	}
+	stripped := strings.TrimPrefix(path, r.Path)
+	if stripped == "" {
+		return "/"
+	}
+	return stripped
+}
@@ -0,0 +1,49 @@
+package handler
+
+import "testing"
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "Success: Empty path becomes root", path: "", want: "/"},
+		{name: "Success: Root path is kept", path: "/", want: "/"},
+		{name: "Success: Leading slash is added", path: "api", want: "/api"},
+		{name: "Success: Trailing slash is removed", path: "/api/", want: "/api"},
+		{name: "Success: Repeated slashes collapse to root", path: "///", want: "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizePath(tt.path); got != tt.want {
+				t.Errorf("NormalizePath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoute_matches(t *testing.T) {
+	tests := []struct {
+		name      string
+		routePath string
+		path      string
+		want      bool
+	}{
+		{name: "Success: Root matches everything", routePath: "/", path: "/anything", want: true},
+		{name: "Success: Exact path matches", routePath: "/api", path: "/api", want: true},
+		{name: "Success: Sub path matches", routePath: "/api", path: "/api/users", want: true},
+		{name: "Error: Partial segment does not match", routePath: "/api", path: "/apiv2", want: false},
+		{name: "Error: Different path does not match", routePath: "/api", path: "/web", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Route{Path: tt.routePath}
+			if got := r.matches(tt.path); got != tt.want {
+				t.Errorf("matches(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
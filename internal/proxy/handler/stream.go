@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// serveUpgrade proxies a protocol upgrade such as a WebSocket handshake. The
+// connection counts against the route's MaxUpgrades until it is closed, and
+// the listener's read and write timeouts do not apply to it. Upgrades are
+// never retried since the upstream may already have switched protocols.
+func (h *ProxyHandler) serveUpgrade(w http.ResponseWriter, r *http.Request, route *Route, host string, upstream *Upstream) {
+	if !route.acquireUpgrade() {
+		h.logger.Warn().
+			Str("host", host).
+			Str("path", route.Path).
+			Int("max_upgrades", route.MaxUpgrades).
+			Msg("Upgraded connection limit reached")
+		serveErrorPage(w, r, http.StatusServiceUnavailable, "Too Many Connections",
+			fmt.Sprintf("%s has reached its limit of %d open connections.", host, route.MaxUpgrades))
+		return
+	}
+	defer route.releaseUpgrade()
+
+	clearDeadlines(w)
+	w = &hijackTrackingWriter{ResponseWriter: w, tracker: h.hijacked}
+	if !h.serveUpstream(w, r, upstream) {
+		serveUnavailable(w, r, route, host)
+	}
+}
+
+// clearDeadlines lifts the listener's read and write timeouts from a
+// long-lived connection. Writers that cannot change deadlines are left as is.
+func clearDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+}
+
+// eventStreamWriter lifts the listener's timeouts from Server-Sent Events
+// responses, which stay open for as long as the client listens. The reverse
+// proxy flushes them after every write.
+type eventStreamWriter struct {
+	http.ResponseWriter
+}
+
+func (w *eventStreamWriter) WriteHeader(status int) {
+	if mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type")); mediaType == "text/event-stream" {
+		clearDeadlines(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *eventStreamWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *eventStreamWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// newTimeoutProxy serves the handler with short listener timeouts, which
+// long-lived connections must not be subject to.
+func newTimeoutProxy(h *ProxyHandler) *httptest.Server {
+	proxy := httptest.NewUnstartedServer(h)
+	proxy.Config.ReadTimeout = 50 * time.Millisecond
+	proxy.Config.WriteTimeout = 50 * time.Millisecond
+	proxy.Start()
+	return proxy
+}
+
+func TestProxyHandler_ServerSentEvents(t *testing.T) {
+	next := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+		<-next
+		time.Sleep(150 * time.Millisecond)
+		_, _ = w.Write([]byte("data: 2\n\n"))
+	}))
+	defer backend.Close()
+
+	h := NewProxyHandler(zerolog.Nop())
+	if err := h.AddRoute(Route{Host: "sse.localhost", Upstreams: createTestUpstreams(t, backend.URL)}); err != nil {
+		t.Fatalf("AddRoute() error = %v", err)
+	}
+	proxy := newTimeoutProxy(h)
+	defer proxy.Close()
+
+	req, err := http.NewRequest(http.MethodGet, proxy.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Host = "sse.localhost"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	first := make(chan string)
+	go func() {
+		line, _ := reader.ReadString('\n')
+		first <- line
+	}()
+	select {
+	case line := <-first:
+		if line != "data: first\n" {
+			t.Fatalf("first event = %q, want data: first", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("first event was not flushed")
+	}
+	close(next)
+
+	// The second event is sent after the listener's write timeout has passed
+	rest := make([]byte, 0, 16)
+	buf := make([]byte, 16)
+	for {
+		n, err := reader.Read(buf)
+		rest = append(rest, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	if got := string(rest); got != "\ndata: 2\n\n" {
+		t.Errorf("rest of stream = %q, want second event", got)
+	}
+}
+
+func TestProxyHandler_UpgradeTimeouts(t *testing.T) {
+	backend := newUpgradeBackend(t)
+	defer backend.Close()
+
+	h := NewProxyHandler(zerolog.Nop())
+	if err := h.AddRoute(Route{Host: "ws.localhost", Upstreams: createTestUpstreams(t, backend.URL)}); err != nil {
+		t.Fatalf("AddRoute() error = %v", err)
+	}
+	proxy := newTimeoutProxy(h)
+	defer proxy.Close()
+
+	conn, reader := dialUpgrade(t, proxy.Listener.Addr().String(), "ws.localhost")
+	defer conn.Close()
+
+	time.Sleep(150 * time.Millisecond)
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatalf("Failed to write to upgraded connection: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if line, err := reader.ReadString('\n'); err != nil || line != "ping\n" {
+		t.Fatalf("echo after listener timeouts = %q, %v, want ping", line, err)
+	}
+}
+
+func TestProxyHandler_UpgradeLimit(t *testing.T) {
+	backend := newUpgradeBackend(t)
+	defer backend.Close()
+
+	h := NewProxyHandler(zerolog.Nop())
+	err := h.AddRoute(Route{Host: "ws.localhost", MaxUpgrades: 1, Upstreams: createTestUpstreams(t, backend.URL)})
+	if err != nil {
+		t.Fatalf("AddRoute() error = %v", err)
+	}
+	proxy := httptest.NewServer(h)
+	defer proxy.Close()
+	addr := proxy.Listener.Addr().String()
+
+	conn, _ := dialUpgrade(t, addr, "ws.localhost")
+	if got := h.GetRoutes()[0].ActiveUpgrades(); got != 1 {
+		t.Errorf("ActiveUpgrades() = %d, want 1", got)
+	}
+
+	rejected, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	defer rejected.Close()
+	_, err = rejected.Write([]byte("GET / HTTP/1.1\r\nHost: ws.localhost\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to write upgrade request: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(rejected), nil)
+	if err != nil {
+		t.Fatalf("Failed to read upgrade response: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("upgrade over limit status = %v, want %v", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	// Plain requests are not limited
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://ws.localhost/", strings.NewReader("")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("plain request status = %v, want %v from the backend", w.Code, http.StatusBadRequest)
+	}
+
+	conn.Close()
+	deadline := time.Now().Add(time.Second)
+	for h.GetRoutes()[0].ActiveUpgrades() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn, _ = dialUpgrade(t, addr, "ws.localhost")
+	conn.Close()
+}
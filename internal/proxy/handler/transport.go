@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Timeouts limits the connections and requests an upstream's reverse proxy
+// makes to the upstream. Zero durations leave the limit unset.
+type Timeouts struct {
+	Dial           time.Duration // Time to establish a connection
+	ResponseHeader time.Duration // Time to wait for the response headers after sending the request
+	Request        time.Duration // Time a request may take, including the response body
+	IdleConn       time.Duration // Time an idle keep-alive connection is kept open
+	MaxIdleConns   int           // Idle keep-alive connections kept open, zero for Go's default of 2
+}
+
+// Protocol is the protocol an upstream's reverse proxy speaks to the upstream.
+type Protocol string
+
+const (
+	ProtocolHTTP Protocol = "http" // HTTP/1.1
+	ProtocolH2C  Protocol = "h2c"  // HTTP/2 without TLS
+	ProtocolGRPC Protocol = "grpc" // gRPC, carried over h2c
+)
+
+// ParseProtocol converts a protocol name into a Protocol. An empty name
+// means HTTP/1.1.
+func ParseProtocol(name string) (Protocol, error) {
+	switch protocol := Protocol(strings.ToLower(name)); protocol {
+	case "":
+		return ProtocolHTTP, nil
+	case ProtocolHTTP, ProtocolH2C, ProtocolGRPC:
+		return protocol, nil
+	default:
+		return "", fmt.Errorf("unknown protocol: %s", name)
+	}
+}
+
+// SetTransport gives the upstream its own transport speaking the protocol and
+// configured with the timeouts. tlsConfig applies to upstreams with an https
+// target, nil verifying their certificate against the system CAs. HTTP/2
+// multiplexes requests over a single connection, so the response header, idle
+// connection and connection pool limits only apply to HTTP/1.1. It must be
+// called before the upstream is added to a route.
+func (u *Upstream) SetTransport(protocol Protocol, tlsConfig *tls.Config, t Timeouts) {
+	dialer := &net.Dialer{Timeout: t.Dial, KeepAlive: 30 * time.Second}
+	switch protocol {
+	case ProtocolH2C, ProtocolGRPC:
+		transport := &http2.Transport{TLSClientConfig: tlsConfig}
+		if u.Target.Scheme == "https" {
+			// HTTP/2 over TLS, with the dial timeout applied to the handshake
+			transport.DialTLSContext = func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				conn, err := dialer.DialContext(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				tlsConn := tls.Client(conn, cfg)
+				if err := tlsConn.HandshakeContext(ctx); err != nil {
+					_ = conn.Close()
+					return nil, err
+				}
+				return tlsConn, nil
+			}
+		} else {
+			transport.AllowHTTP = true
+			transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			}
+		}
+		u.Proxy.Transport = transport
+	default:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = dialer.DialContext
+		transport.TLSClientConfig = tlsConfig
+		transport.ForceAttemptHTTP2 = false
+		transport.ResponseHeaderTimeout = t.ResponseHeader
+		transport.IdleConnTimeout = t.IdleConn
+		transport.MaxIdleConns = t.MaxIdleConns
+		transport.MaxIdleConnsPerHost = t.MaxIdleConns
+		u.Proxy.Transport = transport
+	}
+
+	u.protocol = protocol
+	u.requestTimeout = t.Request
+}
+
+// Protocol returns the protocol spoken to the upstream.
+func (u *Upstream) Protocol() Protocol {
+	if u.protocol == "" {
+		return ProtocolHTTP
+	}
+	return u.protocol
+}
+
+// CloseIdleConnections closes the keep-alive connections to the upstream that
+// are not serving a request, for upstreams that are no longer routed to.
+func (u *Upstream) CloseIdleConnections() {
+	if transport, ok := u.Proxy.Transport.(interface{ CloseIdleConnections() }); ok {
+		transport.CloseIdleConnections()
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
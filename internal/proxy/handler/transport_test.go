@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestProxyHandler_Timeouts(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow-headers":
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		case "/slow-body":
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	tests := []struct {
+		name       string
+		timeouts   Timeouts
+		path       string
+		wantStatus int
+	}{
+		{
+			name:       "Success: Fast response within the timeouts",
+			timeouts:   Timeouts{ResponseHeader: time.Second, Request: time.Second},
+			path:       "/",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Error: Response header timeout",
+			timeouts:   Timeouts{ResponseHeader: 20 * time.Millisecond},
+			path:       "/slow-headers",
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "Error: Request timeout before the headers",
+			timeouts:   Timeouts{Request: 20 * time.Millisecond},
+			path:       "/slow-headers",
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "Error: Request timeout cuts off the body",
+			timeouts:   Timeouts{ResponseHeader: time.Second, Request: 20 * time.Millisecond},
+			path:       "/slow-body",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreams := createTestUpstreams(t, backend.URL)
+			upstreams[0].SetTransport(ProtocolHTTP, nil, tt.timeouts)
+			defer upstreams[0].CloseIdleConnections()
+
+			h := NewProxyHandler(zerolog.Nop())
+			if err := h.AddRoute(Route{Host: "app.localhost", Upstreams: upstreams}); err != nil {
+				t.Fatalf("AddRoute() error = %v", err)
+			}
+
+			done := make(chan *httptest.ResponseRecorder)
+			go func() {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://app.localhost"+tt.path, nil))
+				done <- w
+			}()
+
+			select {
+			case w := <-done:
+				if w.Code != tt.wantStatus {
+					t.Errorf("ServeHTTP() status = %v, want %v", w.Code, tt.wantStatus)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("ServeHTTP() did not time out")
+			}
+		})
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Protocol
+		wantErr bool
+	}{
+		{name: "Success: Empty means HTTP/1.1", value: "", want: ProtocolHTTP},
+		{name: "Success: h2c", value: "h2c", want: ProtocolH2C},
+		{name: "Success: Case-insensitive gRPC", value: "gRPC", want: ProtocolGRPC},
+		{name: "Error: Unknown protocol", value: "http3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProtocol(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseProtocol() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseProtocol() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newH2CClient returns a client that speaks HTTP/2 without TLS.
+func newH2CClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+func TestProxyHandler_HTTP2(t *testing.T) {
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("X-Backend-Proto", r.Proto)
+		_, _ = w.Write([]byte("response"))
+		w.Header().Set("Grpc-Status", "0")
+	}), &http2.Server{}))
+	defer backend.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	tests := []struct {
+		name       string
+		protocol   Protocol
+		backend    string
+		wantProto  string
+		wantStatus string
+	}{
+		{
+			name:      "Success: h2c upstream",
+			protocol:  ProtocolH2C,
+			backend:   backend.URL,
+			wantProto: "HTTP/2.0",
+		},
+		{
+			name:      "Success: gRPC upstream keeps trailers",
+			protocol:  ProtocolGRPC,
+			backend:   backend.URL,
+			wantProto: "HTTP/2.0",
+		},
+		{
+			name:      "Success: HTTP/1.1 upstream",
+			protocol:  ProtocolHTTP,
+			backend:   backend.URL,
+			wantProto: "HTTP/1.1",
+		},
+		{
+			name:       "Error: Unreachable gRPC upstream reports UNAVAILABLE",
+			protocol:   ProtocolGRPC,
+			backend:    dead.URL,
+			wantStatus: grpcUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreams := createTestUpstreams(t, tt.backend)
+			upstreams[0].SetTransport(tt.protocol, nil, Timeouts{})
+			defer upstreams[0].CloseIdleConnections()
+
+			h := NewProxyHandler(zerolog.Nop())
+			if err := h.AddRoute(Route{Host: "grpc.localhost", Upstreams: upstreams}); err != nil {
+				t.Fatalf("AddRoute() error = %v", err)
+			}
+			proxy := httptest.NewServer(h2c.NewHandler(h, &http2.Server{}))
+			defer proxy.Close()
+
+			req, err := http.NewRequest(http.MethodPost, proxy.URL+"/echo.Echo/Say", strings.NewReader("request"))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Host = "grpc.localhost"
+			req.Header.Set("Content-Type", "application/grpc")
+			resp, err := newH2CClient().Do(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			defer resp.Body.Close()
+			_, _ = io.ReadAll(resp.Body)
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %v, want %v", resp.StatusCode, http.StatusOK)
+			}
+			if got := resp.Header.Get("X-Backend-Proto"); got != tt.wantProto {
+				t.Errorf("upstream protocol = %q, want %q", got, tt.wantProto)
+			}
+			if got := resp.Trailer.Get("Grpc-Status"); tt.wantStatus == "" && got != "0" {
+				t.Errorf("Grpc-Status trailer = %q, want 0", got)
+			}
+			if got := resp.Header.Get("Grpc-Status"); got != tt.wantStatus {
+				t.Errorf("Grpc-Status header = %q, want %q", got, tt.wantStatus)
+			}
+		})
+	}
+}
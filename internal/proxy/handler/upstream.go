@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+type Upstream struct {
+	ID            string
+	ContainerName string
+	Labels        map[string]string
+	Target        *url.URL
+	Proxy         *httputil.ReverseProxy
+	RegisteredAt  time.Time
+
+	protocol       Protocol
+	requestTimeout time.Duration
+	activeRequests int64
+	health         int32
+	checkStatus    int32
+	breaker        *circuitBreaker
+}
+
+// HealthStatus is the Docker health check status of an upstream's container.
+type HealthStatus int32
+
+const (
+	HealthNone HealthStatus = iota // The container has no health check
+	HealthStarting
+	HealthHealthy
+	HealthUnhealthy
+)
+
+// ParseHealthStatus converts a Docker health status such as "healthy" into a
+// HealthStatus. Unknown and empty values mean the container has no health check.
+func ParseHealthStatus(status string) HealthStatus {
+	switch status {
+	case "starting":
+		return HealthStarting
+	case "healthy":
+		return HealthHealthy
+	case "unhealthy":
+		return HealthUnhealthy
+	default:
+		return HealthNone
+	}
+}
+
+func (s HealthStatus) passing() bool {
+	return s == HealthNone || s == HealthHealthy
+}
+
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthStarting:
+		return "starting"
+	case HealthHealthy:
+		return "healthy"
+	case HealthUnhealthy:
+		return "unhealthy"
+	default:
+		return "none"
+	}
+}
+
+// NewUpstream creates an upstream whose reverse proxy feeds the upstream's
+// circuit breaker: connection errors, timeouts and 5xx responses count as
+// failures.
+func NewUpstream(id string, target *url.URL) *Upstream {
+	u := &Upstream{
+		ID:           id,
+		Target:       target,
+		Proxy:        httputil.NewSingleHostReverseProxy(target),
+		RegisteredAt: time.Now(),
+		breaker:      newCircuitBreaker(),
+	}
+	u.Proxy.ModifyResponse = func(resp *http.Response) error {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			u.breaker.failure()
+		} else {
+			u.breaker.success()
+		}
+		if attemptFromContext(resp.Request.Context()).retryStatus(resp.StatusCode) {
+			return errRetryableStatus
+		}
+		return nil
+	}
+	u.Proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(err, errRetryableStatus) {
+			return
+		}
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			// The client went away, which says nothing about the upstream
+			u.breaker.cancelled()
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		u.breaker.failure()
+		if attemptFromContext(r.Context()).retryError(r, err) {
+			return
+		}
+		if isTimeout(err) {
+			serveGatewayTimeout(w, r, u)
+			return
+		}
+		serveBadGateway(w, r, u)
+	}
+	return u
+}
+
+func (u *Upstream) ActiveRequests() int64 {
+	return atomic.LoadInt64(&u.activeRequests)
+}
+
+func (u *Upstream) Health() HealthStatus {
+	return HealthStatus(atomic.LoadInt32(&u.health))
+}
+
+func (u *Upstream) SetHealth(status HealthStatus) {
+	atomic.StoreInt32(&u.health, int32(status))
+}
+
+// CheckStatus returns the result of dockname's own health check of the
+// upstream, HealthNone when it is not checked.
+func (u *Upstream) CheckStatus() HealthStatus {
+	return HealthStatus(atomic.LoadInt32(&u.checkStatus))
+}
+
+func (u *Upstream) SetCheckStatus(status HealthStatus) {
+	atomic.StoreInt32(&u.checkStatus, int32(status))
+}
+
+// Available reports whether the upstream may receive requests: neither the
+// Docker health check of its container nor dockname's own health check
+// reports it as starting or unhealthy, and its circuit is not open.
+func (u *Upstream) Available() bool {
+	return u.Health().passing() && u.CheckStatus().passing() && u.breaker.ready()
+}
+
+func (u *Upstream) CircuitState() CircuitState {
+	return u.breaker.State()
+}
+
+// Starting reports whether the upstream is waiting for its first passing
+// health check.
+func (u *Upstream) Starting() bool {
+	return u.Health() == HealthStarting || u.CheckStatus() == HealthStarting
+}
+
+// availableUpstreams returns the upstreams that may receive requests. The
+// given slice is returned as is when all of them are available.
+func availableUpstreams(upstreams []*Upstream) []*Upstream {
+	for i, upstream := range upstreams {
+		if upstream.Available() {
+			continue
+		}
+		available := append(make([]*Upstream, 0, len(upstreams)-1), upstreams[:i]...)
+		for _, u := range upstreams[i+1:] {
+			if u.Available() {
+				available = append(available, u)
+			}
+		}
+		return available
+	}
+	return upstreams
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/kiwamizamurai/dockname/internal/proxy/handler"
+)
+
+// containerHealth returns the health check status of an inspected container.
+func containerHealth(containerJSON types.ContainerJSON) handler.HealthStatus {
+	if containerJSON.ContainerJSONBase == nil || containerJSON.State == nil || containerJSON.State.Health == nil {
+		return handler.HealthNone
+	}
+	return handler.ParseHealthStatus(containerJSON.State.Health.Status)
+}
+
+// listedHealth returns the health check status of a listed container from its
+// status text, such as "Up 5 minutes (healthy)".
+func listedHealth(status string) handler.HealthStatus {
+	switch {
+	case strings.HasSuffix(status, "(health: starting)"):
+		return handler.HealthStarting
+	case strings.HasSuffix(status, "(unhealthy)"):
+		return handler.HealthUnhealthy
+	case strings.HasSuffix(status, "(healthy)"):
+		return handler.HealthHealthy
+	default:
+		return handler.HealthNone
+	}
+}
+
+// setContainerHealth updates the health of every upstream of the container.
+func (m *Manager) setContainerHealth(containerID string, health handler.HealthStatus) {
+	m.containersLock.Lock()
+	defer m.containersLock.Unlock()
+
+	state, ok := m.containers[containerID]
+	if !ok {
+		return
+	}
+	state.health = health
+	for _, upstream := range state.upstreams {
+		upstream.SetHealth(health)
+	}
+
+	m.logger.Info().
+		Str("container_id", containerID).
+		Str("health", health.String()).
+		Msg("Container health changed")
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/kiwamizamurai/dockname/internal/proxy/handler"
+	"github.com/rs/zerolog"
+)
+
+func TestListedHealth(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		want   handler.HealthStatus
+	}{
+		{name: "Success: Starting", status: "Up 3 seconds (health: starting)", want: handler.HealthStarting},
+		{name: "Success: Healthy", status: "Up 2 minutes (healthy)", want: handler.HealthHealthy},
+		{name: "Success: Unhealthy", status: "Up 2 minutes (unhealthy)", want: handler.HealthUnhealthy},
+		{name: "Success: No health check", status: "Up 2 minutes", want: handler.HealthNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listedHealth(tt.status); got != tt.want {
+				t.Errorf("listedHealth() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_HealthEvents(t *testing.T) {
+	containerJSON := testContainerJSON("container1", map[string]string{
+		"dockname.domain":       "app.localhost",
+		"dockname.admin.domain": "admin.localhost",
+	}, "172.17.0.2")
+	containerJSON.State = &types.ContainerState{Health: &types.Health{Status: "starting"}}
+
+	mockManager := &mockManager{
+		InspectContainerFn: func(_ context.Context, _ string) (types.ContainerJSON, error) {
+			return containerJSON, nil
+		},
+	}
+	manager := NewManager(mockManager, nil, zerolog.Nop())
+
+	assertHealth := func(want handler.HealthStatus) {
+		t.Helper()
+		routes := manager.proxyHandler.GetRoutes()
+		if len(routes) != 2 {
+			t.Fatalf("routes = %d, want 2", len(routes))
+		}
+		for _, route := range routes {
+			if got := route.Upstreams[0].Health(); got != want {
+				t.Errorf("health of %s = %v, want %v", route.Host, got, want)
+			}
+		}
+	}
+
+	for _, event := range []struct {
+		action string
+		want   handler.HealthStatus
+	}{
+		{action: "start", want: handler.HealthStarting},
+		{action: "health_status: healthy", want: handler.HealthHealthy},
+		{action: "health_status: unhealthy", want: handler.HealthUnhealthy},
+	} {
+		message := events.Message{Type: "container", Action: event.action, Actor: events.Actor{ID: "container1"}}
+		if err := manager.eventManager.HandleEvent(context.Background(), message); err != nil {
+			t.Fatalf("HandleEvent(%s) error = %v", event.action, err)
+		}
+		assertHealth(event.want)
+	}
+
+	listed := types.Container{
+		ID:              "container1",
+		Labels:          containerJSON.Config.Labels,
+		Status:          "Up 1 minute (unhealthy)",
+		NetworkSettings: &types.SummaryNetworkSettings{Networks: containerJSON.NetworkSettings.Networks},
+	}
+	if !manager.isUpToDate(listed) {
+		t.Error("isUpToDate() = false for an unchanged container, want true")
+	}
+	listed.Status = "Up 1 minute (healthy)"
+	if manager.isUpToDate(listed) {
+		t.Error("isUpToDate() = true for a missed health change, want false")
+	}
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kiwamizamurai/dockname/internal/proxy/handler"
+	"github.com/rs/zerolog"
+)
+
+// healthChecker periodically probes an upstream over HTTP and ejects it from
+// its routes' pools while the probe fails. Any response status below 400
+// counts as passing.
+type healthChecker struct {
+	upstream *handler.Upstream
+	url      string
+	interval time.Duration
+	client   *http.Client
+	cancel   context.CancelFunc
+	done     chan struct{}
+	logger   zerolog.Logger
+}
+
+// startHealthCheck marks the upstream as starting and probes it until stop is
+// called. The upstream receives requests once the first probe passes.
+func startHealthCheck(upstream *handler.Upstream, spec healthCheckSpec, logger zerolog.Logger) *healthChecker {
+	timeout := spec.Timeout
+	if timeout > spec.Interval {
+		timeout = spec.Interval
+	}
+
+	url := upstream.Target.String() + spec.Path
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &healthChecker{
+		upstream: upstream,
+		url:      url,
+		interval: spec.Interval,
+		client: &http.Client{
+			// Probes are sent over the protocol the upstream speaks
+			Transport: upstream.Proxy.Transport,
+			Timeout:   timeout,
+			// A redirect is an answer from a live service, so it is not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+		logger: logger.With().Str("container_id", upstream.ID).Str("url", url).Logger(),
+	}
+
+	upstream.SetCheckStatus(handler.HealthStarting)
+	go c.run(ctx)
+	return c
+}
+
+// stop ends the health check and waits for an in-flight probe to return.
+func (c *healthChecker) stop() {
+	c.cancel()
+	<-c.done
+}
+
+func (c *healthChecker) run(ctx context.Context) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *healthChecker) check(ctx context.Context) {
+	err := c.probe(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+
+	previous := c.upstream.CheckStatus()
+	if err != nil {
+		c.upstream.SetCheckStatus(handler.HealthUnhealthy)
+		if previous != handler.HealthUnhealthy {
+			c.logger.Warn().Err(err).Msg("Upstream health check failed, ejecting upstream")
+		}
+		return
+	}
+
+	c.upstream.SetCheckStatus(handler.HealthHealthy)
+	if previous != handler.HealthHealthy {
+		c.logger.Info().Msg("Upstream health check passed, routing traffic to upstream")
+	}
+}
+
+func (c *healthChecker) probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health check request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/kiwamizamurai/dockname/internal/proxy/handler"
+	"github.com/rs/zerolog"
+)
+
+func waitForCheckStatus(t *testing.T, upstream *handler.Upstream, want handler.HealthStatus) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for upstream.CheckStatus() != want && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := upstream.CheckStatus(); got != want {
+		t.Fatalf("CheckStatus() = %v, want %v", got, want)
+	}
+}
+
+func TestHealthChecker(t *testing.T) {
+	var status int32 = http.StatusOK
+	var requests int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer backend.Close()
+
+	target, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse backend URL: %v", err)
+	}
+	upstream := handler.NewUpstream("container1", target)
+
+	checker := startHealthCheck(upstream, healthCheckSpec{
+		Path:     "/healthz",
+		Interval: 10 * time.Millisecond,
+		Timeout:  time.Second,
+	}, zerolog.Nop())
+
+	waitForCheckStatus(t, upstream, handler.HealthHealthy)
+	if !upstream.Available() {
+		t.Error("Available() = false after a passing check, want true")
+	}
+
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	waitForCheckStatus(t, upstream, handler.HealthUnhealthy)
+	if upstream.Available() {
+		t.Error("Available() = true after a failing check, want false")
+	}
+
+	atomic.StoreInt32(&status, http.StatusMovedPermanently)
+	waitForCheckStatus(t, upstream, handler.HealthHealthy)
+
+	checker.stop()
+	stopped := atomic.LoadInt32(&requests)
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&requests); got != stopped {
+		t.Errorf("requests after stop = %d, want %d", got, stopped)
+	}
+}
+
+func TestManager_HealthCheckLifecycle(t *testing.T) {
+	var requests int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse backend URL: %v", err)
+	}
+	containerJSON := testContainerJSON("container1", map[string]string{
+		"dockname.domain":               "app.localhost",
+		"dockname.port":                 backendURL.Port(),
+		"dockname.healthcheck.path":     "/healthz",
+		"dockname.healthcheck.interval": "10ms",
+	}, backendURL.Hostname())
+
+	mockManager := &mockManager{
+		InspectContainerFn: func(_ context.Context, _ string) (types.ContainerJSON, error) {
+			return containerJSON, nil
+		},
+	}
+	manager := NewManager(mockManager, nil, zerolog.Nop())
+
+	start := events.Message{Type: "container", Action: "start", Actor: events.Actor{ID: "container1"}}
+	if err := manager.eventManager.HandleEvent(context.Background(), start); err != nil {
+		t.Fatalf("HandleEvent(start) error = %v", err)
+	}
+
+	routes := manager.proxyHandler.GetRoutes()
+	if len(routes) != 1 {
+		t.Fatalf("routes = %d, want 1", len(routes))
+	}
+	waitForCheckStatus(t, routes[0].Upstreams[0], handler.HealthUnhealthy)
+
+	stop := events.Message{Type: "container", Action: "stop", Actor: events.Actor{ID: "container1"}}
+	if err := manager.eventManager.HandleEvent(context.Background(), stop); err != nil {
+		t.Fatalf("HandleEvent(stop) error = %v", err)
+	}
+	stopped := atomic.LoadInt32(&requests)
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&requests); got != stopped {
+		t.Errorf("health check requests after stop = %d, want %d", got, stopped)
+	}
+}
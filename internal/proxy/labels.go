@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kiwamizamurai/dockname/internal/proxy/handler"
+)
+
+const labelPrefix = "dockname."
+
+// Route options, set either as dockname.<option> for the container's default
+// service or as dockname.<service>.<option> for a named service.
+const (
+	optionDomain        = "domain"
+	optionAliases       = "aliases"
+	optionHostRegexp    = "hostregexp"
+	optionPort          = "port"
+	optionPath          = "path"
+	optionStripPrefix   = "stripprefix"
+	optionLoadBalancer  = "loadbalancer"
+	optionHTTPSRedirect = "https.redirect"
+	optionNetwork       = "network"
+	optionProtocol      = "protocol"
+	optionScheme        = "scheme"
+
+	optionHealthCheckPath     = "healthcheck.path"
+	optionHealthCheckInterval = "healthcheck.interval"
+	optionHealthCheckTimeout  = "healthcheck.timeout"
+
+	optionRetryAttempts = "retry.attempts"
+	optionRetryStatuses = "retry.statuses"
+
+	optionDialTimeout           = "timeout.dial"
+	optionResponseHeaderTimeout = "timeout.responseheader"
+	optionRequestTimeout        = "timeout.request"
+	optionIdleConnTimeout       = "timeout.idle"
+	optionMaxIdleConns          = "maxidleconns"
+
+	optionTLSCA                 = "tls.ca"
+	optionTLSCert               = "tls.cert"
+	optionTLSKey                = "tls.key"
+	optionTLSServerName         = "tls.servername"
+	optionTLSInsecureSkipVerify = "tls.insecureskipverify"
+
+	optionFlushInterval = "flushinterval"
+	optionMaxUpgrades   = "websocket.maxconns"
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 2 * time.Second
+)
+
+// reservedServiceNames are label namespaces used for options, which therefore
+// cannot name a service.
+var reservedServiceNames = map[string]bool{
+	"https":       true,
+	"healthcheck": true,
+	"retry":       true,
+	"timeout":     true,
+	"tls":         true,
+	"websocket":   true,
+	"tcp":         true,
+	"udp":         true,
+}
+
+type routeSpec struct {
+	Service       string   // Empty for the default service
+	Domains       []string // Domains and aliases the service is reachable on
+	Port          string   // Empty to detect it from the exposed ports
+	Path          string
+	StripPrefix   bool
+	RedirectHTTPS bool
+	LoadBalancer  string
+	Network       string
+	Protocol      string // Empty for HTTP/1.1
+	Scheme        string // Empty for plain HTTP
+	TLS           upstreamTLSSpec
+	HealthCheck   healthCheckSpec
+	RetryAttempts *int // Nil to use the global retry_attempts setting
+	RetryStatuses []int
+	Timeouts      handler.Timeouts // Zero values use the global settings
+	FlushInterval time.Duration    // Zero uses the global flush_interval setting
+	MaxUpgrades   int              // Zero for no limit
+}
+
+// healthCheckSpec configures dockname's own HTTP health check of a service,
+// which is disabled when Path is empty.
+type healthCheckSpec struct {
+	Path     string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// parseRouteLabels returns the routes declared by a container's labels: the
+// default service configured by dockname.domain or dockname.hostregexp
+// followed by every named service configured by dockname.<service>.domain or
+// dockname.<service>.hostregexp, in name order.
+func parseRouteLabels(labels map[string]string) []routeSpec {
+	var specs []routeSpec
+	if spec, ok := parseServiceLabels(labels, ""); ok {
+		specs = append(specs, spec)
+	}
+	for _, service := range serviceNames(labels) {
+		if spec, ok := parseServiceLabels(labels, service); ok {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// serviceNames returns the sorted names of the services that have a
+// dockname.<service>.domain or dockname.<service>.hostregexp label.
+func serviceNames(labels map[string]string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for key := range labels {
+		if !strings.HasPrefix(key, labelPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, labelPrefix)
+		switch {
+		case strings.HasSuffix(name, "."+optionDomain):
+			name = strings.TrimSuffix(name, "."+optionDomain)
+		case strings.HasSuffix(name, "."+optionHostRegexp):
+			name = strings.TrimSuffix(name, "."+optionHostRegexp)
+		default:
+			continue
+		}
+		if name == "" || strings.Contains(name, ".") || reservedServiceNames[name] || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func serviceLabel(service, option string) string {
+	if service == "" {
+		return labelPrefix + option
+	}
+	return labelPrefix + service + "." + option
+}
+
+// parseServiceLabels builds the route of a single service. The load balancer,
+// HTTPS redirect, network, upstream TLS, health check timing, retry, timeout
+// and streaming options fall back to the container-wide labels so they only
+// need to be set once for all services.
+func parseServiceLabels(labels map[string]string, service string) (routeSpec, bool) {
+	domain, hasDomain := labels[serviceLabel(service, optionDomain)]
+	hostRegexp, hasHostRegexp := labels[serviceLabel(service, optionHostRegexp)]
+	if !hasDomain && !hasHostRegexp {
+		return routeSpec{}, false
+	}
+	domains := splitDomains(domain, labels[serviceLabel(service, optionAliases)])
+	// Regexps may contain commas, so the label holds a single expression
+	if hostRegexp = strings.TrimSpace(hostRegexp); hostRegexp != "" {
+		domains = append(domains, handler.RegexpHostPrefix+hostRegexp)
+	}
+	if len(domains) == 0 {
+		return routeSpec{}, false
+	}
+
+	inherited := func(option string) string {
+		if value, ok := labels[serviceLabel(service, option)]; ok {
+			return value
+		}
+		return labels[serviceLabel("", option)]
+	}
+
+	spec := routeSpec{
+		Service:      service,
+		Domains:      domains,
+		Port:         labels[serviceLabel(service, optionPort)],
+		Path:         handler.NormalizePath(labels[serviceLabel(service, optionPath)]),
+		LoadBalancer: inherited(optionLoadBalancer),
+		Network:      inherited(optionNetwork),
+		Protocol:     labels[serviceLabel(service, optionProtocol)],
+		Scheme:       labels[serviceLabel(service, optionScheme)],
+		TLS: upstreamTLSSpec{
+			CA:         inherited(optionTLSCA),
+			Cert:       inherited(optionTLSCert),
+			Key:        inherited(optionTLSKey),
+			ServerName: inherited(optionTLSServerName),
+		},
+	}
+	if stripPrefix, err := strconv.ParseBool(labels[serviceLabel(service, optionStripPrefix)]); err == nil {
+		spec.StripPrefix = stripPrefix
+	}
+	if redirect, err := strconv.ParseBool(inherited(optionHTTPSRedirect)); err == nil {
+		spec.RedirectHTTPS = redirect
+	}
+	if skipVerify, err := strconv.ParseBool(inherited(optionTLSInsecureSkipVerify)); err == nil {
+		spec.TLS.InsecureSkipVerify = skipVerify
+	}
+	if attempts, err := strconv.Atoi(inherited(optionRetryAttempts)); err == nil {
+		spec.RetryAttempts = &attempts
+	}
+	spec.RetryStatuses = parseStatuses(inherited(optionRetryStatuses))
+	spec.Timeouts = handler.Timeouts{
+		Dial:           parsePositiveDuration(inherited(optionDialTimeout), 0),
+		ResponseHeader: parsePositiveDuration(inherited(optionResponseHeaderTimeout), 0),
+		Request:        parsePositiveDuration(inherited(optionRequestTimeout), 0),
+		IdleConn:       parsePositiveDuration(inherited(optionIdleConnTimeout), 0),
+	}
+	if maxIdleConns, err := strconv.Atoi(inherited(optionMaxIdleConns)); err == nil && maxIdleConns > 0 {
+		spec.Timeouts.MaxIdleConns = maxIdleConns
+	}
+	if flushInterval, err := time.ParseDuration(inherited(optionFlushInterval)); err == nil {
+		spec.FlushInterval = flushInterval
+	}
+	if maxUpgrades, err := strconv.Atoi(inherited(optionMaxUpgrades)); err == nil && maxUpgrades > 0 {
+		spec.MaxUpgrades = maxUpgrades
+	}
+	if path := labels[serviceLabel(service, optionHealthCheckPath)]; path != "" {
+		spec.HealthCheck = healthCheckSpec{
+			Path:     "/" + strings.TrimPrefix(path, "/"),
+			Interval: parsePositiveDuration(inherited(optionHealthCheckInterval), defaultHealthCheckInterval),
+			Timeout:  parsePositiveDuration(inherited(optionHealthCheckTimeout), defaultHealthCheckTimeout),
+		}
+	}
+	return spec, true
+}
+
+func parsePositiveDuration(value string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// parseStatuses parses a comma-separated list of HTTP status codes, skipping
+// invalid entries.
+func parseStatuses(value string) []int {
+	var statuses []int
+	for _, field := range strings.Split(value, ",") {
+		status, err := strconv.Atoi(strings.TrimSpace(field))
+		if err == nil && status >= 100 && status <= 599 {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// splitDomains merges comma-separated domain lists, dropping empty entries and
+// duplicates while keeping the order they were listed in.
+func splitDomains(lists ...string) []string {
+	var domains []string
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, domain := range strings.Split(list, ",") {
+			domain = strings.TrimSpace(domain)
+			if domain == "" || seen[domain] {
+				continue
+			}
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
@@ -0,0 +1,253 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kiwamizamurai/dockname/internal/proxy/handler"
+)
+
+func TestParseRouteLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []routeSpec
+	}{
+		{
+			name:   "Success: Defaults are applied",
+			labels: map[string]string{"dockname.domain": "app.localhost"},
+			want:   []routeSpec{{Domains: []string{"app.localhost"}, Path: "/"}},
+		},
+		{
+			name: "Success: Path and strip prefix are parsed",
+			labels: map[string]string{
+				"dockname.domain":         "app.localhost",
+				"dockname.port":           "3000",
+				"dockname.path":           "/api/",
+				"dockname.stripprefix":    "true",
+				"dockname.loadbalancer":   "leastconn",
+				"dockname.https.redirect": "true",
+				"dockname.network":        "frontend",
+			},
+			want: []routeSpec{{
+				Domains:       []string{"app.localhost"},
+				Port:          "3000",
+				Path:          "/api",
+				StripPrefix:   true,
+				RedirectHTTPS: true,
+				LoadBalancer:  "leastconn",
+				Network:       "frontend",
+			}},
+		},
+		{
+			name: "Success: Named services are parsed in name order",
+			labels: map[string]string{
+				"dockname.web.domain":   "app.localhost",
+				"dockname.web.port":     "3000",
+				"dockname.admin.domain": "admin.localhost",
+				"dockname.admin.port":   "9000",
+				"dockname.admin.path":   "/ui",
+			},
+			want: []routeSpec{
+				{Service: "admin", Domains: []string{"admin.localhost"}, Port: "9000", Path: "/ui"},
+				{Service: "web", Domains: []string{"app.localhost"}, Port: "3000", Path: "/"},
+			},
+		},
+		{
+			name: "Success: Services inherit container-wide options",
+			labels: map[string]string{
+				"dockname.domain":               "app.localhost",
+				"dockname.port":                 "3000",
+				"dockname.network":              "frontend",
+				"dockname.https.redirect":       "true",
+				"dockname.admin.domain":         "admin.localhost",
+				"dockname.admin.https.redirect": "false",
+			},
+			want: []routeSpec{
+				{Domains: []string{"app.localhost"}, Port: "3000", Path: "/", RedirectHTTPS: true, Network: "frontend"},
+				{Service: "admin", Domains: []string{"admin.localhost"}, Path: "/", Network: "frontend"},
+			},
+		},
+		{
+			name: "Success: Domain lists and aliases are merged",
+			labels: map[string]string{
+				"dockname.domain":        "app.localhost, www.app.localhost,",
+				"dockname.aliases":       "legacy.localhost,app.localhost",
+				"dockname.admin.domain":  "admin.localhost",
+				"dockname.admin.aliases": "old-admin.localhost",
+			},
+			want: []routeSpec{
+				{Domains: []string{"app.localhost", "www.app.localhost", "legacy.localhost"}, Path: "/"},
+				{Service: "admin", Domains: []string{"admin.localhost", "old-admin.localhost"}, Path: "/"},
+			},
+		},
+		{
+			name: "Success: Wildcard domains and host regexps are parsed",
+			labels: map[string]string{
+				"dockname.domain":            "*.app.localhost",
+				"dockname.tenant.hostregexp": `tenant-[0-9]{1,3}\.localhost`,
+			},
+			want: []routeSpec{
+				{Domains: []string{"*.app.localhost"}, Path: "/"},
+				{Service: "tenant", Domains: []string{`~tenant-[0-9]{1,3}\.localhost`}, Path: "/"},
+			},
+		},
+		{
+			name: "Success: Health checks are parsed with defaults",
+			labels: map[string]string{
+				"dockname.domain":                     "app.localhost",
+				"dockname.healthcheck.path":           "healthz",
+				"dockname.healthcheck.interval":       "5s",
+				"dockname.admin.domain":               "admin.localhost",
+				"dockname.admin.healthcheck.path":     "/ping",
+				"dockname.admin.healthcheck.timeout":  "soon",
+				"dockname.admin.healthcheck.interval": "-1s",
+			},
+			want: []routeSpec{
+				{
+					Domains:     []string{"app.localhost"},
+					Path:        "/",
+					HealthCheck: healthCheckSpec{Path: "/healthz", Interval: 5 * time.Second, Timeout: 2 * time.Second},
+				},
+				{
+					Service:     "admin",
+					Domains:     []string{"admin.localhost"},
+					Path:        "/",
+					HealthCheck: healthCheckSpec{Path: "/ping", Interval: 10 * time.Second, Timeout: 2 * time.Second},
+				},
+			},
+		},
+		{
+			name: "Success: Retry options are parsed and inherited",
+			labels: map[string]string{
+				"dockname.domain":               "app.localhost",
+				"dockname.retry.attempts":       "2",
+				"dockname.retry.statuses":       "502, 503",
+				"dockname.admin.domain":         "admin.localhost",
+				"dockname.admin.retry.attempts": "-1",
+				"dockname.api.domain":           "api.localhost",
+				"dockname.api.retry.statuses":   "600",
+			},
+			want: []routeSpec{
+				{Domains: []string{"app.localhost"}, Path: "/", RetryAttempts: intPtr(2), RetryStatuses: []int{502, 503}},
+				{Service: "admin", Domains: []string{"admin.localhost"}, Path: "/", RetryAttempts: intPtr(-1), RetryStatuses: []int{502, 503}},
+				{Service: "api", Domains: []string{"api.localhost"}, Path: "/", RetryAttempts: intPtr(2)},
+			},
+		},
+		{
+			name: "Success: Timeouts are parsed and inherited",
+			labels: map[string]string{
+				"dockname.domain":                 "app.localhost",
+				"dockname.timeout.dial":           "2s",
+				"dockname.timeout.responseheader": "5s",
+				"dockname.timeout.idle":           "never",
+				"dockname.maxidleconns":           "8",
+				"dockname.upload.domain":          "upload.localhost",
+				"dockname.upload.timeout.request": "10m",
+				"dockname.upload.maxidleconns":    "-1",
+			},
+			want: []routeSpec{
+				{
+					Domains:  []string{"app.localhost"},
+					Path:     "/",
+					Timeouts: handler.Timeouts{Dial: 2 * time.Second, ResponseHeader: 5 * time.Second, MaxIdleConns: 8},
+				},
+				{
+					Service:  "upload",
+					Domains:  []string{"upload.localhost"},
+					Path:     "/",
+					Timeouts: handler.Timeouts{Dial: 2 * time.Second, ResponseHeader: 5 * time.Second, Request: 10 * time.Minute},
+				},
+			},
+		},
+		{
+			name: "Success: Streaming options are parsed and inherited",
+			labels: map[string]string{
+				"dockname.domain":                 "app.localhost",
+				"dockname.flushinterval":          "-1ms",
+				"dockname.websocket.maxconns":     "50",
+				"dockname.hmr.domain":             "hmr.localhost",
+				"dockname.hmr.websocket.maxconns": "0",
+			},
+			want: []routeSpec{
+				{Domains: []string{"app.localhost"}, Path: "/", FlushInterval: -time.Millisecond, MaxUpgrades: 50},
+				{Service: "hmr", Domains: []string{"hmr.localhost"}, Path: "/", FlushInterval: -time.Millisecond},
+			},
+		},
+		{
+			name: "Success: Protocol is set per service",
+			labels: map[string]string{
+				"dockname.domain":       "app.localhost",
+				"dockname.api.domain":   "api.localhost",
+				"dockname.api.protocol": "grpc",
+				"dockname.api.port":     "50051",
+				"dockname.grpcweb.port": "8080",
+			},
+			want: []routeSpec{
+				{Domains: []string{"app.localhost"}, Path: "/"},
+				{Service: "api", Domains: []string{"api.localhost"}, Port: "50051", Path: "/", Protocol: "grpc"},
+			},
+		},
+		{
+			name: "Success: Upstream TLS options are parsed and inherited",
+			labels: map[string]string{
+				"dockname.domain":                 "auth.localhost",
+				"dockname.scheme":                 "https",
+				"dockname.tls.ca":                 "/certs/ca.pem",
+				"dockname.tls.insecureskipverify": "yes",
+				"dockname.admin.domain":           "admin.localhost",
+				"dockname.admin.scheme":           "https",
+				"dockname.admin.tls.servername":   "admin.internal",
+				"dockname.admin.tls.cert":         "/certs/client.pem",
+				"dockname.admin.tls.key":          "/certs/client-key.pem",
+			},
+			want: []routeSpec{
+				{Domains: []string{"auth.localhost"}, Path: "/", Scheme: "https", TLS: upstreamTLSSpec{CA: "/certs/ca.pem"}},
+				{
+					Service: "admin",
+					Domains: []string{"admin.localhost"},
+					Path:    "/",
+					Scheme:  "https",
+					TLS: upstreamTLSSpec{
+						CA:         "/certs/ca.pem",
+						Cert:       "/certs/client.pem",
+						Key:        "/certs/client-key.pem",
+						ServerName: "admin.internal",
+					},
+				},
+			},
+		},
+		{
+			name:   "Error: Empty domain list",
+			labels: map[string]string{"dockname.domain": " , "},
+			want:   nil,
+		},
+		{
+			name: "Success: Reserved namespaces are not services",
+			labels: map[string]string{
+				"dockname.https.domain":       "https.localhost",
+				"dockname.healthcheck.domain": "health.localhost",
+				"dockname.a.b.domain":         "nested.localhost",
+			},
+			want: nil,
+		},
+		{
+			name:   "Error: Missing domain label",
+			labels: map[string]string{"dockname.port": "3000"},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRouteLabels(tt.labels); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRouteLabels() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
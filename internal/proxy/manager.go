@@ -2,41 +2,131 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/kiwamizamurai/dockname/internal/admin"
+	"github.com/kiwamizamurai/dockname/internal/certs"
 	"github.com/kiwamizamurai/dockname/internal/container"
 	"github.com/kiwamizamurai/dockname/internal/events"
 	"github.com/kiwamizamurai/dockname/internal/proxy/handler"
+	"github.com/kiwamizamurai/dockname/internal/proxy/tcp"
 	"github.com/rs/zerolog"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type Config struct {
-	Port           string
-	UpdateInterval time.Duration
-	RetryAttempts  int
-	RetryDelay     time.Duration
+	Port            string        `yaml:"port"`
+	HTTPSPort       string        `yaml:"https_port"` // Empty disables the TLS listener
+	CertDir         string        `yaml:"cert_dir"`   // Directory holding the development CA
+	AdminPort       string        `yaml:"admin_port"` // Empty disables the unauthenticated admin API
+	TCPPort         string        `yaml:"tcp_port"`   // Empty disables TLS passthrough by SNI
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	Network         string        `yaml:"network"`         // Preferred network to reach containers on
+	DomainTemplate  string        `yaml:"domain_template"` // Empty disables automatic domains
+	UpdateInterval  time.Duration `yaml:"update_interval"`
+	RetryAttempts   int           `yaml:"retry_attempts"`
+	RetryDelay      time.Duration `yaml:"retry_delay"`
+
+	// Limits of connections to upstreams, overridable per route with labels
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"` // Zero waits indefinitely
+	RequestTimeout        time.Duration `yaml:"request_timeout"`         // Zero waits indefinitely
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
+	MaxIdleConns          int           `yaml:"max_idle_conns"` // Per upstream
+	// FlushInterval is how often streamed responses are flushed to the client,
+	// negative to flush after every write. Server-Sent Events are always
+	// flushed immediately.
+	FlushInterval time.Duration `yaml:"flush_interval"`
+
+	// Limits of client connections to the HTTP and HTTPS listeners
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`  // Zero allows uploads of any duration
+	WriteTimeout      time.Duration `yaml:"write_timeout"` // Zero allows streaming responses of any duration
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
 }
 
 func DefaultConfig() *Config {
 	return &Config{
-		Port:           ":80",
-		UpdateInterval: 10 * time.Second,
-		RetryAttempts:  3,
-		RetryDelay:     time.Second,
+		Port:            ":80",
+		HTTPSPort:       ":443",
+		CertDir:         "/var/lib/dockname/certs",
+		ShutdownTimeout: 10 * time.Second,
+		UpdateInterval:  10 * time.Second,
+		RetryAttempts:   3,
+		RetryDelay:      time.Second,
+
+		DialTimeout:       10 * time.Second,
+		IdleConnTimeout:   90 * time.Second,
+		MaxIdleConns:      100,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
 	}
 }
 
+// minRetryDelay and maxRetryDelay bound the exponential backoff between
+// reconnection attempts. The minimum keeps a zero retry_delay, which is fine
+// for retried requests, from reconnecting and resyncing in a tight loop.
+const (
+	minRetryDelay = 100 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
+)
+
+type routeKey struct {
+	host string
+	path string
+}
+
 type Manager struct {
 	containerManager container.Manager
 	eventManager     *events.Manager
 	proxyHandler     *handler.ProxyHandler
+	sniProxy         *tcp.SNIProxy // Nil when tcp_port is not set
+	forwarder        *tcp.Forwarder
 	config           *Config
 	logger           zerolog.Logger
+
+	// containers maps each registered container ID to the routes it is an upstream of
+	containers     map[string]*containerState
+	containersLock sync.Mutex
+	// generation is incremented whenever a container is registered or
+	// unregistered and when reconciliation lists the containers, so that
+	// reconciliation can tell which changes happened after its list was taken
+	generation uint64
+	// unregisteredAt holds the generation each container was last
+	// unregistered at until no reconciliation in progress needs it
+	unregisteredAt map[string]uint64
+	// reconcileLock serializes reconciliations
+	reconcileLock sync.Mutex
+
+	// ownNetworks holds the networks dockname's own container is attached to
+	ownNetworks map[string]bool
+	// domainTemplate generates the domain of containers without a domain label
+	domainTemplate *template.Template
+}
+
+type containerState struct {
+	routes    []routeKey
+	tcpRoutes []string   // Hosts the container is a backend of on the SNI proxy
+	forwards  []tcp.Port // Ports forwarded to the container
+	upstreams []*handler.Upstream
+	// health is the Docker health status the upstreams were last updated with
+	health   handler.HealthStatus
+	checkers []*healthChecker
+	// signature identifies the labels and network addresses the routes were built from
+	signature string
+	// generation is the manager generation the container was registered at
+	generation uint64
 }
 
 func NewManager(containerManager container.Manager, config *Config, logger zerolog.Logger) *Manager {
@@ -46,43 +136,200 @@ func NewManager(containerManager container.Manager, config *Config, logger zerol
 
 	eventManager := events.NewManager(logger)
 	proxyHandler := handler.NewProxyHandler(logger)
+	proxyHandler.SetRetryDelay(config.RetryDelay)
 
-	return &Manager{
+	m := &Manager{
 		containerManager: containerManager,
 		eventManager:     eventManager,
 		proxyHandler:     proxyHandler,
 		config:           config,
 		logger:           logger,
+		containers:       make(map[string]*containerState),
+		unregisteredAt:   make(map[string]uint64),
+		forwarder:        tcp.NewForwarder(config.DialTimeout, logger),
+	}
+	if config.TCPPort != "" {
+		m.sniProxy = tcp.NewSNIProxy(config.DialTimeout, logger)
 	}
+
+	if config.DomainTemplate != "" {
+		domainTemplate, err := parseDomainTemplate(config.DomainTemplate)
+		if err != nil {
+			logger.Error().Err(err).Msg("invalid domain template, automatic domains are disabled")
+		} else {
+			m.domainTemplate = domainTemplate
+		}
+	}
+
+	startHandler := &containerStartHandler{manager: m}
+	stopHandler := &containerStopHandler{manager: m}
+	eventManager.RegisterHandler(events.EventStart, startHandler)
+	eventManager.RegisterHandler(events.EventStop, stopHandler)
+	eventManager.RegisterHandler(events.EventDie, stopHandler)
+	eventManager.RegisterHandler(events.EventKill, &containerKillHandler{manager: m})
+	eventManager.RegisterHandler(events.EventHealthStatus, &containerHealthHandler{manager: m})
+
+	return m
+}
+
+type namedServer struct {
+	name   string
+	addr   string
+	server interface {
+		Shutdown(ctx context.Context) error
+		Close() error
+	}
+	serve func() error
 }
 
+// Start runs the proxy until ctx is cancelled, then drains in-flight requests
+// for up to ShutdownTimeout and returns nil once all listeners are closed.
 func (m *Manager) Start(ctx context.Context) error {
-	go func() {
-		<-ctx.Done()
-		m.logger.Info().Msg("Stopping proxy manager")
-	}()
+	m.detectOwnNetworks(ctx)
+	defer m.stopHealthChecks()
 
 	if err := m.initializeContainers(ctx); err != nil {
 		return fmt.Errorf("failed to detect initial containers: %w", err)
 	}
 
 	go func() {
-		if err := m.watchContainers(ctx); err != nil {
+		if err := m.watchContainers(ctx); err != nil && !errors.Is(err, context.Canceled) {
 			m.logger.Error().Err(err).Msg("failed to watch containers")
 		}
 	}()
 
-	server := &http.Server{
-		Addr:    m.config.Port,
-		Handler: m.proxyHandler,
+	go m.reconcileLoop(ctx)
+
+	servers := m.newServers()
+	serverErr := make(chan error, len(servers))
+	for _, server := range servers {
+		server := server
+		go func() {
+			m.logger.Info().Str("port", server.addr).Msgf("Starting %s server", server.name)
+			if err := server.serve(); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, tcp.ErrServerClosed) {
+				serverErr <- fmt.Errorf("failed to start %s server: %w", server.name, err)
+			}
+		}()
 	}
 
-	m.logger.Info().Str("port", m.config.Port).Msg("Starting HTTP server")
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		return fmt.Errorf("failed to start HTTP server: %w", err)
+	var err error
+	select {
+	case <-ctx.Done():
+		m.logger.Info().Msg("Stopping proxy manager")
+	case err = <-serverErr:
 	}
 
-	return nil
+	m.shutdown(servers)
+	return err
+}
+
+func (m *Manager) newServers() []namedServer {
+	var servers []namedServer
+
+	httpServer := m.newProxyServer(m.config.Port)
+	// Accept HTTP/2 without TLS (h2c) on the plain listener for gRPC clients.
+	// Configuring the server lets Shutdown close these connections gracefully.
+	h2Server := &http2.Server{}
+	if err := http2.ConfigureServer(httpServer, h2Server); err != nil {
+		m.logger.Warn().Err(err).Msg("failed to configure HTTP/2, h2c disabled")
+	} else {
+		httpServer.Handler = h2c.NewHandler(httpServer.Handler, h2Server)
+	}
+	servers = append(servers, namedServer{name: "HTTP", addr: httpServer.Addr, server: httpServer, serve: httpServer.ListenAndServe})
+
+	if tlsServer := m.newTLSServer(); tlsServer != nil {
+		servers = append(servers, namedServer{name: "HTTPS", addr: tlsServer.Addr, server: tlsServer, serve: func() error {
+			return tlsServer.ListenAndServeTLS("", "")
+		}})
+	}
+
+	if m.sniProxy != nil {
+		servers = append(servers, namedServer{name: "TCP", addr: m.config.TCPPort, server: m.sniProxy, serve: func() error {
+			return m.sniProxy.ListenAndServe(m.config.TCPPort)
+		}})
+	}
+
+	if m.config.AdminPort != "" {
+		adminServer := &http.Server{
+			Addr:    m.config.AdminPort,
+			Handler: admin.NewServer(m.proxyHandler, m.logger),
+		}
+		servers = append(servers, namedServer{name: "admin API", addr: adminServer.Addr, server: adminServer, serve: adminServer.ListenAndServe})
+	}
+
+	return servers
+}
+
+func (m *Manager) newProxyServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           m.proxyHandler,
+		ReadHeaderTimeout: m.config.ReadHeaderTimeout,
+		ReadTimeout:       m.config.ReadTimeout,
+		WriteTimeout:      m.config.WriteTimeout,
+		IdleTimeout:       m.config.IdleTimeout,
+	}
+}
+
+// shutdown stops accepting connections and waits for in-flight requests to
+// finish. Upgraded connections are not drained by http.Server, so they are
+// closed right away; connections still busy after the timeout are closed
+// forcibly.
+func (m *Manager) shutdown(servers []namedServer) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.ShutdownTimeout)
+	defer cancel()
+
+	if closed := m.proxyHandler.CloseHijackedConns(); closed > 0 {
+		m.logger.Info().Int("connections", closed).Msg("Closed upgraded connections")
+	}
+
+	// Forwarded ports are opened on demand rather than served like the others
+	servers = append(servers, namedServer{name: "port forwarding", server: m.forwarder})
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server namedServer) {
+			defer wg.Done()
+			if err := server.server.Shutdown(ctx); err != nil {
+				m.logger.Warn().Err(err).Msgf("%s server did not drain in time, closing remaining connections", server.name)
+				_ = server.server.Close()
+			}
+		}(server)
+	}
+	wg.Wait()
+
+	// Requests upgraded while draining are closed as well
+	m.proxyHandler.CloseHijackedConns()
+	m.logger.Info().Msg("Proxy manager stopped")
+}
+
+// newTLSServer prepares the HTTPS listener backed by the development CA. It
+// returns nil when HTTPS is disabled or the CA cannot be loaded, in which case
+// dockname keeps serving plain HTTP only.
+func (m *Manager) newTLSServer() *http.Server {
+	if m.config.HTTPSPort == "" {
+		return nil
+	}
+
+	_, port, err := net.SplitHostPort(m.config.HTTPSPort)
+	if err != nil {
+		m.logger.Error().Err(err).Str("port", m.config.HTTPSPort).Msg("invalid HTTPS port, HTTPS disabled")
+		return nil
+	}
+
+	authority, err := certs.NewAuthority(m.config.CertDir, m.proxyHandler.HasHost, m.logger)
+	if err != nil {
+		m.logger.Error().Err(err).Str("cert_dir", m.config.CertDir).Msg("failed to load development CA, HTTPS disabled")
+		return nil
+	}
+	m.logger.Info().Str("path", authority.CertPath()).Msg("Trust this CA certificate to access routes over HTTPS")
+
+	m.proxyHandler.SetHTTPSPort(port)
+
+	server := m.newProxyServer(m.config.HTTPSPort)
+	server.TLSConfig = authority.TLSConfig()
+	return server
 }
 
 func (m *Manager) initializeContainers(ctx context.Context) error {
@@ -93,91 +340,447 @@ func (m *Manager) initializeContainers(ctx context.Context) error {
 
 	m.logger.Info().Int("container_count", len(containers)).Msg("Getting initial container list")
 	for _, container := range containers {
+		// A misconfigured container must not keep the others from being
+		// routed; reconciliation retries it.
 		if err := m.registerContainer(ctx, container); err != nil {
 			m.logger.Error().Err(err).Str("container_id", container.ID).Msg("failed to register container")
-			return fmt.Errorf("failed to register container %s: %w", container.ID, err)
 		}
 	}
 	return nil
 }
 
+// watchContainers follows the Docker event stream, reconnecting with
+// exponential backoff when it fails. Reconnections resume from the last seen
+// event and are followed by a full resync of the route table. A negative
+// RetryAttempts retries forever.
 func (m *Manager) watchContainers(ctx context.Context) error {
-	eventsChan, errChan := m.containerManager.WatchEvents(ctx)
+	var since time.Time
+	failures := 0
 
 	for {
+		connectedAt := time.Now()
+		lastSeen, received, err := m.streamEvents(ctx, since, failures > 0)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !lastSeen.IsZero() {
+			since = lastSeen
+		} else if since.IsZero() {
+			since = connectedAt
+		}
+		if received || time.Since(connectedAt) >= maxRetryDelay {
+			failures = 0
+		}
+
+		failures++
+		if m.config.RetryAttempts >= 0 && failures > m.config.RetryAttempts {
+			m.logger.Error().Err(err).Msg("error monitoring events")
+			return fmt.Errorf("error monitoring events: %w", err)
+		}
+
+		delay := m.retryDelay(failures)
+		m.logger.Warn().Err(err).
+			Int("attempt", failures).
+			Dur("delay", delay).
+			Msg("Event stream disconnected, reconnecting")
+
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case event := <-eventsChan:
+		case <-time.After(delay):
+		}
+	}
+}
+
+// streamEvents dispatches container events until the stream fails. It returns
+// the time of the last event seen and whether any event was received.
+func (m *Manager) streamEvents(ctx context.Context, since time.Time, resync bool) (time.Time, bool, error) {
+	eventsChan, errChan := m.containerManager.WatchEvents(ctx, since)
+
+	if resync {
+		m.logger.Info().Time("since", since).Msg("Reconnected to event stream, resyncing routes")
+		if err := m.reconcile(ctx); err != nil {
+			m.logger.Error().Err(err).Msg("failed to reconcile routes")
+		}
+	}
+
+	var lastSeen time.Time
+	received := false
+	for {
+		select {
+		case <-ctx.Done():
+			return lastSeen, received, ctx.Err()
+		case event, ok := <-eventsChan:
+			if !ok {
+				return lastSeen, received, errors.New("event stream closed")
+			}
+			received = true
+			if event.TimeNano != 0 {
+				lastSeen = time.Unix(0, event.TimeNano)
+			}
 			if event.Type != "container" {
 				continue
 			}
 
 			if err := m.eventManager.HandleEvent(ctx, event); err != nil {
 				m.logger.Error().Err(err).
-					Str("container_id", event.ID).
+					Str("container_id", eventContainerID(event)).
 					Str("action", event.Action).
 					Msg("failed to handle container event")
 			}
-		case err := <-errChan:
+		case err, ok := <-errChan:
+			if !ok {
+				return lastSeen, received, errors.New("event stream closed")
+			}
 			if err != nil {
-				m.logger.Error().Err(err).Msg("error monitoring events")
-				return fmt.Errorf("error monitoring events: %w", err)
+				return lastSeen, received, err
 			}
 		}
 	}
 }
 
+func (m *Manager) retryDelay(attempt int) time.Duration {
+	delay := m.config.RetryDelay
+	if delay < minRetryDelay {
+		delay = minRetryDelay
+	}
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
 func (m *Manager) registerContainer(ctx context.Context, container types.Container) error {
-	domain, ok := container.Labels["dockname.domain"]
-	if !ok {
+	routes := m.containerRoutes(container)
+	if routes.empty() {
 		m.logger.Info().
 			Str("container_id", container.ID).
 			Interface("labels", container.Labels).
-			Msg("dockname.domain label not found, skipping container")
+			Msg("no route configured, skipping container")
 		return nil
 	}
 
-	port := container.Labels["dockname.port"]
-	if port == "" {
-		port = "80" // Default port
-	}
+	return m.registerRoutes(ctx, container, routes)
+}
 
+func (m *Manager) registerRoutes(ctx context.Context, container types.Container, routes containerRoutes) error {
 	containerJSON, err := m.containerManager.InspectContainer(ctx, container.ID)
 	if err != nil {
 		return fmt.Errorf("failed to inspect container: %w", err)
 	}
 
-	var containerIP string
-	for networkName, network := range containerJSON.NetworkSettings.Networks {
-		if network.IPAddress != "" {
-			containerIP = network.IPAddress
-			m.logger.Info().
-				Str("container_id", container.ID).
-				Str("network", networkName).
-				Str("ip", containerIP).
-				Msg("Got container IP address")
-			break
+	return m.addContainerRoutes(container, containerJSON, routes)
+}
+
+// addContainerRoutes registers the container as an upstream of the route of
+// every service it declares and as a backend of its TCP domains and forwarded
+// ports. A service that fails to register does not keep the others from being
+// routed.
+func (m *Manager) addContainerRoutes(container types.Container, containerJSON types.ContainerJSON, routes containerRoutes) error {
+	if containerJSON.NetworkSettings == nil {
+		return fmt.Errorf("container network settings not found: %s", container.ID)
+	}
+
+	m.containersLock.Lock()
+	defer m.containersLock.Unlock()
+
+	if routes.listedAt > 0 && m.changedSince(container.ID, routes.listedAt) {
+		// A container event was handled while reconciliation inspected the
+		// container, so the inspected state may be outdated
+		m.logger.Debug().Str("container_id", container.ID).Msg("container changed during reconciliation, skipping")
+		return nil
+	}
+
+	state := &containerState{
+		health:    containerHealth(containerJSON),
+		signature: containerSignature(container.Labels, containerJSON.NetworkSettings.Networks),
+	}
+	var errs []error
+	for _, spec := range routes.http {
+		keys := make([]routeKey, 0, len(spec.Domains))
+		for _, domain := range spec.Domains {
+			key := routeKey{host: domain, path: spec.Path}
+			if containsRouteKey(state.routes, key) {
+				errs = append(errs, fmt.Errorf("route %s%s is declared by several services of container %s", domain, spec.Path, container.ID))
+				continue
+			}
+			keys = append(keys, key)
+		}
+		upstream, err := m.addServiceRoutes(container, containerJSON, spec, keys)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if upstream != nil {
+			state.upstreams = append(state.upstreams, upstream)
+			if spec.HealthCheck.Path != "" {
+				state.checkers = append(state.checkers, startHealthCheck(upstream, spec.HealthCheck, m.logger))
+			}
 		}
+		for _, key := range keys {
+			if m.proxyHandler.HasUpstream(key.host, key.path, container.ID) {
+				state.routes = append(state.routes, key)
+			}
+		}
+	}
+	if routes.tcp != nil {
+		hosts, err := m.addTCPRoutes(container, containerJSON, *routes.tcp)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		state.tcpRoutes = hosts
+	}
+	if len(routes.forwards) > 0 {
+		ports, err := m.addForwards(container, containerJSON, routes.forwards)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		state.forwards = ports
 	}
+	if len(errs) > 0 {
+		// Leave the signature empty so the next reconciliation retries the
+		// services that failed.
+		state.signature = ""
+	}
+	m.trackContainer(container.ID, state)
+
+	return errors.Join(errs...)
+}
 
-	if containerIP == "" {
-		return fmt.Errorf("container IP address not found: %s", container.ID)
+// addServiceRoutes adds the container as an upstream of a service's route on
+// each of its domains and returns the upstream. It must be called with
+// containersLock held.
+func (m *Manager) addServiceRoutes(container types.Container, containerJSON types.ContainerJSON, spec routeSpec, keys []routeKey) (*handler.Upstream, error) {
+	networkName, containerIP, err := selectNetwork(containerJSON.NetworkSettings.Networks, spec.Network, m.config.Network, m.ownNetworks)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, container.ID)
 	}
+	m.logger.Info().
+		Str("container_id", container.ID).
+		Str("service", spec.Service).
+		Str("network", networkName).
+		Str("ip", containerIP).
+		Msg("Got container IP address")
 
-	targetURL, err := url.Parse(fmt.Sprintf("http://%s:%s", containerIP, port))
+	scheme, err := parseScheme(spec.Scheme)
 	if err != nil {
-		return fmt.Errorf("failed to parse URL: %w", err)
+		return nil, fmt.Errorf("%w: %s", err, container.ID)
+	}
+	spec.Scheme = scheme
+	protocol, err := handler.ParseProtocol(spec.Protocol)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, container.ID)
+	}
+	var tlsConfig *tls.Config
+	if scheme == schemeHTTPS {
+		if tlsConfig, err = upstreamTLSConfig(spec.TLS); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, container.ID)
+		}
+	}
+
+	port := spec.Port
+	if port == "" {
+		port = m.detectPort(container, containerJSON, spec)
+	}
+
+	targetURL, err := url.Parse(fmt.Sprintf("%s://%s:%s", scheme, containerIP, port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	upstream := handler.NewUpstream(container.ID, targetURL)
+	upstream.ContainerName = containerName(container)
+	upstream.Labels = container.Labels
+	upstream.SetHealth(containerHealth(containerJSON))
+	if spec.HealthCheck.Path != "" {
+		// Keep the upstream out of its pools until the first check passes
+		upstream.SetCheckStatus(handler.HealthStarting)
+	}
+	upstream.SetTransport(protocol, tlsConfig, m.upstreamTimeouts(spec))
+	upstream.Proxy.FlushInterval = m.config.FlushInterval
+	if spec.FlushInterval != 0 {
+		upstream.Proxy.FlushInterval = spec.FlushInterval
+	}
+
+	retryAttempts := m.config.RetryAttempts
+	if spec.RetryAttempts != nil {
+		retryAttempts = *spec.RetryAttempts
+	}
+
+	var errs []error
+	for _, key := range keys {
+		route := handler.Route{
+			Host:          key.host,
+			Path:          key.path,
+			StripPrefix:   spec.StripPrefix,
+			RedirectHTTPS: spec.RedirectHTTPS,
+			LoadBalancer:  spec.LoadBalancer,
+			RetryAttempts: retryAttempts,
+			RetryStatuses: spec.RetryStatuses,
+			MaxUpgrades:   spec.MaxUpgrades,
+		}
+		if err := m.proxyHandler.AddUpstream(route, upstream); err != nil {
+			errs = append(errs, fmt.Errorf("failed to add route %s: %w", key.host, err))
+			continue
+		}
+
+		m.logger.Info().
+			Str("container_id", container.ID).
+			Str("service", spec.Service).
+			Str("domain", key.host).
+			Str("path", key.path).
+			Str("target", targetURL.String()).
+			Msg("Registered container")
+	}
+	return upstream, errors.Join(errs...)
+}
+
+// upstreamTimeouts returns the global upstream timeouts with the ones set by
+// the service's labels applied.
+func (m *Manager) upstreamTimeouts(spec routeSpec) handler.Timeouts {
+	timeouts := handler.Timeouts{
+		Dial:           m.config.DialTimeout,
+		ResponseHeader: m.config.ResponseHeaderTimeout,
+		Request:        m.config.RequestTimeout,
+		IdleConn:       m.config.IdleConnTimeout,
+		MaxIdleConns:   m.config.MaxIdleConns,
+	}
+	if spec.Timeouts.Dial > 0 {
+		timeouts.Dial = spec.Timeouts.Dial
+	}
+	if spec.Timeouts.ResponseHeader > 0 {
+		timeouts.ResponseHeader = spec.Timeouts.ResponseHeader
+	}
+	if spec.Timeouts.Request > 0 {
+		timeouts.Request = spec.Timeouts.Request
 	}
+	if spec.Timeouts.IdleConn > 0 {
+		timeouts.IdleConn = spec.Timeouts.IdleConn
+	}
+	if spec.Timeouts.MaxIdleConns > 0 {
+		timeouts.MaxIdleConns = spec.Timeouts.MaxIdleConns
+	}
+	return timeouts
+}
 
-	proxy := httputil.NewSingleHostReverseProxy(targetURL)
-	m.proxyHandler.AddRoute(domain, proxy)
+// trackContainer records the routes of a container, removing it from routes it
+// was previously registered on but no longer belongs to. It must be called with
+// containersLock held.
+func (m *Manager) trackContainer(containerID string, state *containerState) {
+	m.generation++
+	state.generation = m.generation
+	delete(m.unregisteredAt, containerID)
+
+	if previous, ok := m.containers[containerID]; ok {
+		previous.release()
+		for _, key := range previous.routes {
+			if !containsRouteKey(state.routes, key) {
+				m.removeContainerRoute(containerID, key)
+			}
+		}
+		for _, host := range previous.tcpRoutes {
+			if !containsString(state.tcpRoutes, host) {
+				m.removeTCPRoute(containerID, host)
+			}
+		}
+		for _, port := range previous.forwards {
+			if !containsPort(state.forwards, port) {
+				m.removeForward(containerID, port)
+			}
+		}
+	}
+	m.containers[containerID] = state
+}
+
+func (m *Manager) unregisterContainer(containerID string) {
+	m.containersLock.Lock()
+	defer m.containersLock.Unlock()
+	m.removeContainer(containerID)
+}
+
+// removeContainer removes the container from all of its routes. It must be
+// called with containersLock held.
+func (m *Manager) removeContainer(containerID string) {
+	m.generation++
+	m.unregisteredAt[containerID] = m.generation
+
+	state, ok := m.containers[containerID]
+	if !ok {
+		return
+	}
+	for _, key := range state.routes {
+		m.removeContainerRoute(containerID, key)
+	}
+	for _, host := range state.tcpRoutes {
+		m.removeTCPRoute(containerID, host)
+	}
+	for _, port := range state.forwards {
+		m.removeForward(containerID, port)
+	}
+	state.release()
+	delete(m.containers, containerID)
+}
+
+// release stops the health checks of upstreams that are no longer routed to
+// and closes their idle connections.
+func (s *containerState) release() {
+	s.stopHealthChecks()
+	for _, upstream := range s.upstreams {
+		upstream.CloseIdleConnections()
+	}
+}
+
+func (s *containerState) stopHealthChecks() {
+	for _, checker := range s.checkers {
+		checker.stop()
+	}
+	s.checkers = nil
+}
+
+// stopHealthChecks ends the health checks of all containers.
+func (m *Manager) stopHealthChecks() {
+	m.containersLock.Lock()
+	defer m.containersLock.Unlock()
+
+	for _, state := range m.containers {
+		state.stopHealthChecks()
+	}
+}
+
+func (m *Manager) removeContainerRoute(containerID string, key routeKey) {
+	m.proxyHandler.RemoveUpstream(key.host, key.path, containerID)
 
 	m.logger.Info().
-		Str("container_id", container.ID).
-		Str("domain", domain).
-		Str("target", targetURL.String()).
-		Msg("Registered container")
+		Str("container_id", containerID).
+		Str("domain", key.host).
+		Str("path", key.path).
+		Msg("Unregistered container")
+}
 
-	return nil
+func containerName(container types.Container) string {
+	if len(container.Names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(container.Names[0], "/")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRouteKey(keys []routeKey, key routeKey) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
 }
@@ -3,6 +3,7 @@ package proxy
 import (
 	"context"
 	"errors"
+	"reflect"
 	"testing"
 	"time"
 
@@ -15,7 +16,7 @@ import (
 type mockManager struct {
 	ListContainersFn   func(ctx context.Context) ([]types.Container, error)
 	InspectContainerFn func(ctx context.Context, containerID string) (types.ContainerJSON, error)
-	WatchEventsFn      func(ctx context.Context) (<-chan events.Message, <-chan error)
+	WatchEventsFn      func(ctx context.Context, since time.Time) (<-chan events.Message, <-chan error)
 }
 
 func (m *mockManager) ListContainers(ctx context.Context) ([]types.Container, error) {
@@ -32,9 +33,9 @@ func (m *mockManager) InspectContainer(ctx context.Context, containerID string)
 	return types.ContainerJSON{}, nil
 }
 
-func (m *mockManager) WatchEvents(ctx context.Context) (<-chan events.Message, <-chan error) {
+func (m *mockManager) WatchEvents(ctx context.Context, since time.Time) (<-chan events.Message, <-chan error) {
 	if m.WatchEventsFn != nil {
-		return m.WatchEventsFn(ctx)
+		return m.WatchEventsFn(ctx, since)
 	}
 	msgChan := make(chan events.Message)
 	errChan := make(chan error)
@@ -76,7 +77,7 @@ func TestManager_Start(t *testing.T) {
 				},
 			}, nil
 		},
-		WatchEventsFn: func(ctx context.Context) (<-chan events.Message, <-chan error) {
+		WatchEventsFn: func(ctx context.Context, _ time.Time) (<-chan events.Message, <-chan error) {
 			eventsChan := make(chan events.Message)
 			errChan := make(chan error)
 
@@ -106,16 +107,16 @@ func TestManager_Start(t *testing.T) {
 	defer cancel()
 
 	config := &Config{
-		Port:           ":8080",
-		UpdateInterval: 100 * time.Millisecond,
+		Port:            "127.0.0.1:0",
+		UpdateInterval:  100 * time.Millisecond,
+		ShutdownTimeout: time.Second,
 	}
 	manager := NewManager(mockManager, config, zerolog.Nop())
 
 	// Start the manager in a goroutine
+	done := make(chan error, 1)
 	go func() {
-		if err := manager.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
-			t.Errorf("Manager.Start() error = %v", err)
-		}
+		done <- manager.Start(ctx)
 	}()
 
 	// Wait for a short period to allow the manager to process events
@@ -123,6 +124,50 @@ func TestManager_Start(t *testing.T) {
 
 	// Cancel the context to stop the manager
 	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Manager.Start() error = %v, want nil after shutdown", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Manager.Start() did not return after context cancellation")
+	}
+}
+
+func TestManager_Start_PartialConfig(t *testing.T) {
+	manager := NewManager(&mockManager{}, &Config{Port: "127.0.0.1:0"}, zerolog.Nop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- manager.Start(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Manager.Start() error = %v, want nil after shutdown", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Manager.Start() did not return after context cancellation")
+	}
+}
+
+func TestManager_Start_ListenError(t *testing.T) {
+	config := &Config{
+		Port:            "invalid-address",
+		UpdateInterval:  time.Second,
+		ShutdownTimeout: time.Second,
+	}
+	manager := NewManager(&mockManager{}, config, zerolog.Nop())
+
+	if err := manager.Start(context.Background()); err == nil {
+		t.Error("Manager.Start() error = nil, want listen error")
+	}
 }
 
 func TestManager_initializeContainers(t *testing.T) {
@@ -130,6 +175,7 @@ func TestManager_initializeContainers(t *testing.T) {
 		name       string
 		containers []types.Container
 		setupMock  func(*mockManager)
+		wantHosts  []string // Checked when set
 		wantErr    bool
 	}{
 		{
@@ -170,7 +216,7 @@ func TestManager_initializeContainers(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name: "Error: Container inspection fails",
+			name: "Success: Container inspection failure is skipped",
 			containers: []types.Container{
 				{
 					ID: "container1",
@@ -196,6 +242,38 @@ func TestManager_initializeContainers(t *testing.T) {
 					return types.ContainerJSON{}, errors.New("inspect error")
 				}
 			},
+			wantErr: false,
+		},
+		{
+			name: "Success: Misconfigured container does not keep others from being routed",
+			setupMock: func(m *mockManager) {
+				containers := map[string]types.ContainerJSON{
+					"good": testContainerJSON("good", map[string]string{"dockname.domain": "good.localhost"}, "172.17.0.2"),
+					"bad": testContainerJSON("bad", map[string]string{
+						"dockname.domain": "bad.localhost",
+						"dockname.scheme": "https",
+						"dockname.tls.ca": "/nonexistent/ca.pem",
+					}, "172.17.0.3"),
+				}
+				m.ListContainersFn = func(_ context.Context) ([]types.Container, error) {
+					return []types.Container{
+						{ID: "bad", Labels: containers["bad"].Config.Labels},
+						{ID: "good", Labels: containers["good"].Config.Labels},
+					}, nil
+				}
+				m.InspectContainerFn = func(_ context.Context, containerID string) (types.ContainerJSON, error) {
+					return containers[containerID], nil
+				}
+			},
+			wantHosts: []string{"good.localhost"},
+		},
+		{
+			name: "Error: Listing containers fails",
+			setupMock: func(m *mockManager) {
+				m.ListContainersFn = func(_ context.Context) ([]types.Container, error) {
+					return nil, errors.New("list error")
+				}
+			},
 			wantErr: true,
 		},
 	}
@@ -214,6 +292,203 @@ func TestManager_initializeContainers(t *testing.T) {
 			if (err != nil) != tt.wantErr {
 				t.Errorf("initializeContainers() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if tt.wantHosts != nil {
+				var hosts []string
+				for _, route := range manager.proxyHandler.GetRoutes() {
+					hosts = append(hosts, route.Host)
+				}
+				if !reflect.DeepEqual(hosts, tt.wantHosts) {
+					t.Errorf("routed hosts = %v, want %v", hosts, tt.wantHosts)
+				}
+			}
 		})
 	}
 }
+
+func TestManager_newTLSServer(t *testing.T) {
+	tests := []struct {
+		name       string
+		httpsPort  string
+		wantServer bool
+	}{
+		{
+			name:       "Success: TLS server is created",
+			httpsPort:  ":8443",
+			wantServer: true,
+		},
+		{
+			name:       "Success: HTTPS is disabled",
+			httpsPort:  "",
+			wantServer: false,
+		},
+		{
+			name:       "Error: Invalid HTTPS port disables HTTPS",
+			httpsPort:  "8443",
+			wantServer: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				Port:      ":8080",
+				HTTPSPort: tt.httpsPort,
+				CertDir:   t.TempDir(),
+			}
+			manager := NewManager(&mockManager{}, config, zerolog.Nop())
+
+			server := manager.newTLSServer()
+			if (server != nil) != tt.wantServer {
+				t.Fatalf("newTLSServer() = %v, wantServer %v", server, tt.wantServer)
+			}
+			if server != nil && server.TLSConfig.GetCertificate == nil {
+				t.Error("newTLSServer() TLS config does not issue certificates")
+			}
+		})
+	}
+}
+
+func TestManager_watchContainers(t *testing.T) {
+	eventTime := time.Unix(1700000000, 500)
+
+	tests := []struct {
+		name          string
+		retryAttempts int
+		streams       []func(ctx context.Context, eventsChan chan<- events.Message, errChan chan<- error)
+		wantErr       bool
+		wantCalls     int
+		wantResyncs   int
+		wantSince     time.Time
+	}{
+		{
+			name:          "Success: Reconnects and resumes after stream error",
+			retryAttempts: 1,
+			streams: []func(ctx context.Context, eventsChan chan<- events.Message, errChan chan<- error){
+				func(_ context.Context, eventsChan chan<- events.Message, errChan chan<- error) {
+					eventsChan <- events.Message{Type: "container", Action: "exec_start", TimeNano: eventTime.UnixNano()}
+					errChan <- errors.New("connection reset")
+				},
+				func(_ context.Context, _ chan<- events.Message, errChan chan<- error) {
+					errChan <- errors.New("daemon unavailable")
+				},
+			},
+			wantErr:     true,
+			wantCalls:   2,
+			wantResyncs: 1,
+			wantSince:   eventTime,
+		},
+		{
+			name:          "Error: Gives up after retry attempts are exhausted",
+			retryAttempts: 2,
+			streams: []func(ctx context.Context, eventsChan chan<- events.Message, errChan chan<- error){
+				func(_ context.Context, _ chan<- events.Message, errChan chan<- error) {
+					errChan <- errors.New("daemon unavailable")
+				},
+				func(_ context.Context, _ chan<- events.Message, errChan chan<- error) {
+					errChan <- errors.New("daemon unavailable")
+				},
+				func(_ context.Context, _ chan<- events.Message, errChan chan<- error) {
+					errChan <- errors.New("daemon unavailable")
+				},
+			},
+			wantErr:     true,
+			wantCalls:   3,
+			wantResyncs: 2,
+		},
+		{
+			name:          "Success: Stops on context cancellation",
+			retryAttempts: -1,
+			streams: []func(ctx context.Context, eventsChan chan<- events.Message, errChan chan<- error){
+				func(_ context.Context, _ chan<- events.Message, errChan chan<- error) {
+					errChan <- errors.New("daemon unavailable")
+				},
+				func(ctx context.Context, _ chan<- events.Message, errChan chan<- error) {
+					<-ctx.Done()
+					errChan <- ctx.Err()
+				},
+			},
+			wantErr:     true,
+			wantCalls:   2,
+			wantResyncs: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var sinces []time.Time
+			resyncs := 0
+			mockManager := &mockManager{
+				ListContainersFn: func(_ context.Context) ([]types.Container, error) {
+					resyncs++
+					return nil, nil
+				},
+				WatchEventsFn: func(ctx context.Context, since time.Time) (<-chan events.Message, <-chan error) {
+					eventsChan := make(chan events.Message, 1)
+					errChan := make(chan error, 1)
+					call := len(sinces)
+					sinces = append(sinces, since)
+					if call == len(tt.streams)-1 && tt.retryAttempts < 0 {
+						go func() {
+							time.Sleep(20 * time.Millisecond)
+							cancel()
+						}()
+					}
+					go tt.streams[call](ctx, eventsChan, errChan)
+					return eventsChan, errChan
+				},
+			}
+
+			config := DefaultConfig()
+			config.RetryAttempts = tt.retryAttempts
+			config.RetryDelay = time.Millisecond
+			manager := NewManager(mockManager, config, zerolog.Nop())
+
+			err := manager.watchContainers(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("watchContainers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(sinces) != tt.wantCalls {
+				t.Fatalf("WatchEvents() calls = %d, want %d", len(sinces), tt.wantCalls)
+			}
+			if resyncs != tt.wantResyncs {
+				t.Errorf("resyncs = %d, want %d", resyncs, tt.wantResyncs)
+			}
+			if !sinces[0].IsZero() {
+				t.Errorf("first WatchEvents() since = %v, want zero", sinces[0])
+			}
+			for _, since := range sinces[1:] {
+				if since.IsZero() {
+					t.Error("reconnection did not resume from a timestamp")
+				}
+			}
+			if !tt.wantSince.IsZero() && !sinces[1].Equal(tt.wantSince) {
+				t.Errorf("reconnection since = %v, want last event time %v", sinces[1], tt.wantSince)
+			}
+		})
+	}
+}
+
+func TestManager_retryDelay(t *testing.T) {
+	tests := []struct {
+		retryDelay time.Duration
+		attempt    int
+		want       time.Duration
+	}{
+		{retryDelay: time.Second, attempt: 1, want: time.Second},
+		{retryDelay: time.Second, attempt: 2, want: 2 * time.Second},
+		{retryDelay: time.Second, attempt: 4, want: 8 * time.Second},
+		{retryDelay: time.Second, attempt: 10, want: maxRetryDelay},
+		{retryDelay: 0, attempt: 1, want: minRetryDelay},
+		{retryDelay: 0, attempt: 3, want: 4 * minRetryDelay},
+	}
+
+	for _, tt := range tests {
+		manager := NewManager(&mockManager{}, &Config{RetryDelay: tt.retryDelay}, zerolog.Nop())
+		if got := manager.retryDelay(tt.attempt); got != tt.want {
+			t.Errorf("retryDelay(%d) with retry_delay %v = %v, want %v", tt.attempt, tt.retryDelay, got, tt.want)
+		}
+	}
+}
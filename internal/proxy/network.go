@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/docker/docker/api/types/network"
+)
+
+// selectNetwork picks the network used to reach a container. The network
+// named by the container's label wins, followed by the globally configured
+// default network, networks dockname itself is attached to and finally any
+// other network. Candidates of the same rank are tried in name order so the
+// choice does not depend on map iteration order.
+func selectNetwork(networks map[string]*network.EndpointSettings, labelNetwork, defaultNetwork string, ownNetworks map[string]bool) (string, string, error) {
+	if labelNetwork != "" {
+		endpoint, ok := networks[labelNetwork]
+		if !ok || endpoint == nil || endpoint.IPAddress == "" {
+			return "", "", fmt.Errorf("container has no IP address on network %s", labelNetwork)
+		}
+		return labelNetwork, endpoint.IPAddress, nil
+	}
+
+	names := make([]string, 0, len(networks))
+	for name, endpoint := range networks {
+		if endpoint != nil && endpoint.IPAddress != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", "", fmt.Errorf("container IP address not found")
+	}
+
+	rank := func(name string) int {
+		switch {
+		case name == defaultNetwork:
+			return 0
+		case ownNetworks[name]:
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if rank(names[i]) != rank(names[j]) {
+			return rank(names[i]) < rank(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	return names[0], networks[names[0]].IPAddress, nil
+}
+
+// detectOwnNetworks records the networks of the container dockname runs in,
+// if any. Docker sets the hostname of a container to its short ID.
+func (m *Manager) detectOwnNetworks(ctx context.Context) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return
+	}
+
+	containerJSON, err := m.containerManager.InspectContainer(ctx, hostname)
+	if err != nil || containerJSON.NetworkSettings == nil {
+		m.logger.Debug().Str("hostname", hostname).Msg("dockname is not running in a container, no network preference")
+		return
+	}
+
+	ownNetworks := make(map[string]bool, len(containerJSON.NetworkSettings.Networks))
+	for name := range containerJSON.NetworkSettings.Networks {
+		ownNetworks[name] = true
+		m.logger.Info().Str("network", name).Msg("Preferring network dockname is attached to")
+	}
+	m.ownNetworks = ownNetworks
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/network"
+)
+
+func TestSelectNetwork(t *testing.T) {
+	networks := map[string]*network.EndpointSettings{
+		"backend":  {IPAddress: "172.18.0.2"},
+		"bridge":   {IPAddress: "172.17.0.2"},
+		"frontend": {IPAddress: "172.19.0.2"},
+		"none":     {},
+	}
+
+	tests := []struct {
+		name           string
+		networks       map[string]*network.EndpointSettings
+		labelNetwork   string
+		defaultNetwork string
+		ownNetworks    map[string]bool
+		wantNetwork    string
+		wantIP         string
+		wantErr        bool
+	}{
+		{
+			name:         "Success: Label network wins",
+			networks:     networks,
+			labelNetwork: "frontend", defaultNetwork: "backend",
+			ownNetworks: map[string]bool{"bridge": true},
+			wantNetwork: "frontend", wantIP: "172.19.0.2",
+		},
+		{
+			name:           "Success: Default network before own networks",
+			networks:       networks,
+			defaultNetwork: "frontend",
+			ownNetworks:    map[string]bool{"bridge": true},
+			wantNetwork:    "frontend", wantIP: "172.19.0.2",
+		},
+		{
+			name:           "Success: Own network when default network is not attached",
+			networks:       networks,
+			defaultNetwork: "missing",
+			ownNetworks:    map[string]bool{"frontend": true, "bridge": true},
+			wantNetwork:    "bridge", wantIP: "172.17.0.2",
+		},
+		{
+			name:        "Success: Networks are ordered by name without preference",
+			networks:    networks,
+			wantNetwork: "backend", wantIP: "172.18.0.2",
+		},
+		{
+			name:         "Error: Label network not attached",
+			networks:     networks,
+			labelNetwork: "missing",
+			wantErr:      true,
+		},
+		{
+			name:         "Error: Label network without IP address",
+			networks:     networks,
+			labelNetwork: "none",
+			wantErr:      true,
+		},
+		{
+			name:     "Error: No network with an IP address",
+			networks: map[string]*network.EndpointSettings{"none": {}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotNetwork, gotIP, err := selectNetwork(tt.networks, tt.labelNetwork, tt.defaultNetwork, tt.ownNetworks)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectNetwork() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotNetwork != tt.wantNetwork || gotIP != tt.wantIP {
+				t.Errorf("selectNetwork() = %v, %v, want %v, %v", gotNetwork, gotIP, tt.wantNetwork, tt.wantIP)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-connections/nat"
+)
+
+// defaultPort and defaultTLSPort are used for containers that neither set
+// dockname.port nor expose a TCP port.
+const (
+	defaultPort    = "80"
+	defaultTLSPort = "443"
+)
+
+// preferredPorts and preferredTLSPorts are picked, in this order, when a
+// container exposes several TCP ports.
+var (
+	preferredPorts    = []int{80, 8080, 3000, 8000, 5000}
+	preferredTLSPorts = []int{443, 8443, 9443}
+)
+
+// selectPort picks the upstream port among the exposed ports of a container:
+// the only exposed TCP port, else the first preferred port for the scheme that
+// is exposed, else the lowest one. ambiguous is true when several TCP ports
+// were exposed.
+func selectPort(exposed nat.PortSet, scheme string) (port string, ambiguous bool) {
+	preferred, fallback := preferredPorts, defaultPort
+	if scheme == schemeHTTPS {
+		preferred, fallback = preferredTLSPorts, defaultTLSPort
+	}
+
+	var ports []int
+	for p := range exposed {
+		if p.Proto() == "tcp" && p.Int() > 0 {
+			ports = append(ports, p.Int())
+		}
+	}
+
+	switch len(ports) {
+	case 0:
+		return fallback, false
+	case 1:
+		return strconv.Itoa(ports[0]), false
+	}
+
+	sort.Ints(ports)
+	for _, want := range preferred {
+		for _, p := range ports {
+			if p == want {
+				return strconv.Itoa(p), true
+			}
+		}
+	}
+	return strconv.Itoa(ports[0]), true
+}
+
+// detectPort returns the port of a service without a dockname.port label.
+func (m *Manager) detectPort(container types.Container, containerJSON types.ContainerJSON, spec routeSpec) string {
+	var exposed nat.PortSet
+	if containerJSON.Config != nil {
+		exposed = containerJSON.Config.ExposedPorts
+	}
+
+	port, ambiguous := selectPort(exposed, spec.Scheme)
+	if ambiguous {
+		m.logger.Warn().
+			Str("container_id", container.ID).
+			Str("service", spec.Service).
+			Str("port", port).
+			Msgf("container exposes several ports, set %s to choose one", serviceLabel(spec.Service, optionPort))
+	} else {
+		m.logger.Debug().
+			Str("container_id", container.ID).
+			Str("service", spec.Service).
+			Str("port", port).
+			Msg("Detected container port")
+	}
+	return port
+}
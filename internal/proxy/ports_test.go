@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-connections/nat"
+	"github.com/rs/zerolog"
+)
+
+func TestSelectPort(t *testing.T) {
+	tests := []struct {
+		name          string
+		exposed       nat.PortSet
+		scheme        string
+		want          string
+		wantAmbiguous bool
+	}{
+		{
+			name:    "Success: No exposed port falls back to 80",
+			exposed: nil,
+			want:    "80",
+		},
+		{
+			name:    "Success: Sole TCP port",
+			exposed: nat.PortSet{"3000/tcp": {}, "53/udp": {}},
+			want:    "3000",
+		},
+		{
+			name:          "Success: Preferred port among several",
+			exposed:       nat.PortSet{"9229/tcp": {}, "3000/tcp": {}, "8080/tcp": {}},
+			want:          "8080",
+			wantAmbiguous: true,
+		},
+		{
+			name:          "Success: Lowest port without a preferred one",
+			exposed:       nat.PortSet{"9000/tcp": {}, "4000/tcp": {}},
+			want:          "4000",
+			wantAmbiguous: true,
+		},
+		{
+			name:    "Success: UDP-only container falls back to 80",
+			exposed: nat.PortSet{"53/udp": {}},
+			want:    "80",
+		},
+		{
+			name:          "Success: TLS port preferred for HTTPS",
+			exposed:       nat.PortSet{"8080/tcp": {}, "8443/tcp": {}},
+			scheme:        "https",
+			want:          "8443",
+			wantAmbiguous: true,
+		},
+		{
+			name:    "Success: HTTPS container without exposed port falls back to 443",
+			exposed: nil,
+			scheme:  "https",
+			want:    "443",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ambiguous := selectPort(tt.exposed, tt.scheme)
+			if got != tt.want || ambiguous != tt.wantAmbiguous {
+				t.Errorf("selectPort() = %v, %v, want %v, %v", got, ambiguous, tt.want, tt.wantAmbiguous)
+			}
+		})
+	}
+}
+
+func TestManager_DetectedPort(t *testing.T) {
+	labels := map[string]string{
+		"dockname.domain":       "app.localhost",
+		"dockname.admin.domain": "admin.localhost",
+		"dockname.admin.port":   "9000",
+	}
+	containerJSON := testContainerJSON("container1", labels, "172.17.0.2")
+	containerJSON.Config.ExposedPorts = nat.PortSet{"3000/tcp": {}}
+
+	manager := NewManager(&mockManager{}, nil, zerolog.Nop())
+	container := types.Container{ID: "container1", Labels: labels}
+	if err := manager.addContainerRoutes(container, containerJSON, manager.containerRoutes(container)); err != nil {
+		t.Fatalf("addContainerRoutes() error = %v", err)
+	}
+
+	want := map[string]string{
+		"app.localhost":   "172.17.0.2:3000",
+		"admin.localhost": "172.17.0.2:9000",
+	}
+	for _, route := range manager.proxyHandler.GetRoutes() {
+		if got := route.Upstreams[0].Target.Host; got != want[route.Host] {
+			t.Errorf("upstream of %s = %v, want %v", route.Host, got, want[route.Host])
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+)
+
+func (m *Manager) reconcileLoop(ctx context.Context) {
+	if m.config.UpdateInterval <= 0 {
+		m.logger.Warn().
+			Dur("update_interval", m.config.UpdateInterval).
+			Msg("update interval is not positive, periodic reconciliation is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(m.config.UpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.reconcile(ctx); err != nil {
+				m.logger.Error().Err(err).Msg("failed to reconcile routes")
+			}
+		}
+	}
+}
+
+// reconcile brings the route table in line with the running containers. It
+// registers containers whose routes are missing or were built from outdated
+// labels or addresses, and unregisters containers that are no longer running.
+// Containers registered or unregistered by events after the list was taken
+// are left alone, as the events are more recent than the list.
+func (m *Manager) reconcile(ctx context.Context) error {
+	m.reconcileLock.Lock()
+	defer m.reconcileLock.Unlock()
+
+	m.containersLock.Lock()
+	m.generation++
+	listedAt := m.generation
+	m.containersLock.Unlock()
+	defer m.pruneUnregistered(listedAt)
+
+	containers, err := m.containerManager.ListContainers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	running := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		running[container.ID] = true
+	}
+
+	m.containersLock.Lock()
+	var stale []string
+	for containerID, state := range m.containers {
+		if !running[containerID] && state.generation < listedAt {
+			stale = append(stale, containerID)
+		}
+	}
+	m.containersLock.Unlock()
+
+	for _, containerID := range stale {
+		m.unregisterStale(containerID, listedAt)
+	}
+
+	for _, container := range containers {
+		routes := m.containerRoutes(container)
+		if routes.empty() {
+			continue
+		}
+		if m.isUpToDate(container) {
+			continue
+		}
+
+		m.logger.Info().Str("container_id", container.ID).Msg("Reconciling container routes")
+		routes.listedAt = listedAt
+		if err := m.registerRoutes(ctx, container, routes); err != nil {
+			m.logger.Error().Err(err).Str("container_id", container.ID).Msg("failed to register container")
+		}
+	}
+	return nil
+}
+
+// unregisterStale unregisters a container found stopped by the
+// reconciliation that listed the containers at listedAt, unless it was
+// registered again since.
+func (m *Manager) unregisterStale(containerID string, listedAt uint64) {
+	m.containersLock.Lock()
+	defer m.containersLock.Unlock()
+
+	if state, ok := m.containers[containerID]; ok && state.generation < listedAt {
+		m.logger.Info().Str("container_id", containerID).Msg("Reconciling stopped container")
+		m.removeContainer(containerID)
+	}
+}
+
+// changedSince reports whether the container was registered or unregistered
+// after the given generation. It must be called with containersLock held.
+func (m *Manager) changedSince(containerID string, generation uint64) bool {
+	if state, ok := m.containers[containerID]; ok && state.generation > generation {
+		return true
+	}
+	return m.unregisteredAt[containerID] > generation
+}
+
+// pruneUnregistered forgets the unregistrations that happened before the
+// reconciliation started at the given generation, which only reconciliations
+// need to know about.
+func (m *Manager) pruneUnregistered(generation uint64) {
+	m.containersLock.Lock()
+	defer m.containersLock.Unlock()
+
+	for containerID, unregisteredAt := range m.unregisteredAt {
+		if unregisteredAt <= generation {
+			delete(m.unregisteredAt, containerID)
+		}
+	}
+}
+
+func (m *Manager) isUpToDate(container types.Container) bool {
+	m.containersLock.Lock()
+	defer m.containersLock.Unlock()
+
+	state, ok := m.containers[container.ID]
+	if !ok {
+		return false
+	}
+
+	var networks map[string]*network.EndpointSettings
+	if container.NetworkSettings != nil {
+		networks = container.NetworkSettings.Networks
+	}
+	if state.signature != containerSignature(container.Labels, networks) || state.health != listedHealth(container.Status) {
+		return false
+	}
+
+	for _, key := range state.routes {
+		if !m.proxyHandler.HasUpstream(key.host, key.path, container.ID) {
+			return false
+		}
+	}
+	for _, host := range state.tcpRoutes {
+		if !m.sniProxy.HasBackend(host, container.ID) {
+			return false
+		}
+	}
+	for _, port := range state.forwards {
+		if !m.forwarder.HasBackend(port, container.ID) {
+			return false
+		}
+	}
+	return true
+}
+
+func containerSignature(labels map[string]string, networks map[string]*network.EndpointSettings) string {
+	parts := make([]string, 0, len(labels)+len(networks))
+	for key, value := range labels {
+		parts = append(parts, "label:"+key+"="+value)
+	}
+	for name, endpoint := range networks {
+		if endpoint != nil {
+			parts = append(parts, "network:"+name+"="+endpoint.IPAddress)
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,288 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/rs/zerolog"
+)
+
+func testListedContainer(id, domain, ip string) types.Container {
+	return types.Container{
+		ID:     id,
+		Names:  []string{"/" + id},
+		Labels: map[string]string{"dockname.domain": domain},
+		NetworkSettings: &types.SummaryNetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"bridge": {IPAddress: ip},
+			},
+		},
+	}
+}
+
+// fakeDocker serves a mutable set of running containers to the manager.
+type fakeDocker struct {
+	mu          sync.Mutex
+	containers  []types.Container
+	inspections int
+}
+
+func (f *fakeDocker) set(containers ...types.Container) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.containers = containers
+}
+
+func (f *fakeDocker) mock() *mockManager {
+	return &mockManager{
+		ListContainersFn: func(_ context.Context) ([]types.Container, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			return append([]types.Container(nil), f.containers...), nil
+		},
+		InspectContainerFn: func(_ context.Context, containerID string) (types.ContainerJSON, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.inspections++
+			for _, c := range f.containers {
+				if c.ID == containerID {
+					return testContainerJSON(c.ID, c.Labels, c.NetworkSettings.Networks["bridge"].IPAddress), nil
+				}
+			}
+			return types.ContainerJSON{}, errors.New("no such container")
+		},
+	}
+}
+
+func routeTargets(m *Manager) map[string][]string {
+	targets := make(map[string][]string)
+	for _, route := range m.proxyHandler.GetRoutes() {
+		for _, upstream := range route.Upstreams {
+			targets[route.Host] = append(targets[route.Host], upstream.Target.String())
+		}
+	}
+	return targets
+}
+
+func TestManager_reconcile(t *testing.T) {
+	docker := &fakeDocker{}
+	manager := NewManager(docker.mock(), nil, zerolog.Nop())
+	ctx := context.Background()
+
+	steps := []struct {
+		name            string
+		containers      []types.Container
+		prepare         func()
+		wantTargets     map[string][]string
+		wantInspections int
+	}{
+		{
+			name: "Success: Missing containers are registered",
+			containers: []types.Container{
+				testListedContainer("web", "web.localhost", "172.17.0.2"),
+				testListedContainer("api", "api.localhost", "172.17.0.3"),
+			},
+			wantTargets: map[string][]string{
+				"web.localhost": {"http://172.17.0.2:80"},
+				"api.localhost": {"http://172.17.0.3:80"},
+			},
+			wantInspections: 2,
+		},
+		{
+			name: "Success: Unchanged containers are not inspected again",
+			containers: []types.Container{
+				testListedContainer("web", "web.localhost", "172.17.0.2"),
+				testListedContainer("api", "api.localhost", "172.17.0.3"),
+			},
+			wantTargets: map[string][]string{
+				"web.localhost": {"http://172.17.0.2:80"},
+				"api.localhost": {"http://172.17.0.3:80"},
+			},
+			wantInspections: 2,
+		},
+		{
+			name: "Success: Stopped containers are unregistered and changed ones updated",
+			containers: []types.Container{
+				testListedContainer("web", "web.localhost", "172.17.0.9"),
+			},
+			wantTargets: map[string][]string{
+				"web.localhost": {"http://172.17.0.9:80"},
+			},
+			wantInspections: 3,
+		},
+		{
+			name: "Success: Routes removed behind the manager's back are restored",
+			containers: []types.Container{
+				testListedContainer("web", "web.localhost", "172.17.0.9"),
+			},
+			prepare: func() {
+				manager.proxyHandler.RemoveRoute("web.localhost", "/")
+			},
+			wantTargets: map[string][]string{
+				"web.localhost": {"http://172.17.0.9:80"},
+			},
+			wantInspections: 4,
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			docker.set(step.containers...)
+			if step.prepare != nil {
+				step.prepare()
+			}
+
+			if err := manager.reconcile(ctx); err != nil {
+				t.Fatalf("reconcile() error = %v", err)
+			}
+
+			if got := routeTargets(manager); !reflect.DeepEqual(got, step.wantTargets) {
+				t.Errorf("routes = %v, want %v", got, step.wantTargets)
+			}
+			if docker.inspections != step.wantInspections {
+				t.Errorf("inspections = %d, want %d", docker.inspections, step.wantInspections)
+			}
+		})
+	}
+}
+
+func TestManager_reconcileLoop(t *testing.T) {
+	docker := &fakeDocker{}
+	config := DefaultConfig()
+	config.UpdateInterval = 10 * time.Millisecond
+	manager := NewManager(docker.mock(), config, zerolog.Nop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		manager.reconcileLoop(ctx)
+		close(done)
+	}()
+
+	docker.set(testListedContainer("web", "web.localhost", "172.17.0.2"))
+
+	deadline := time.After(time.Second)
+	for !manager.proxyHandler.HasHost("web.localhost") {
+		select {
+		case <-deadline:
+			t.Fatal("reconcileLoop() did not register the container")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reconcileLoop() did not stop after context cancellation")
+	}
+}
+
+func TestManager_reconcileLoop_NonPositiveInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		manager := NewManager(&mockManager{}, &Config{UpdateInterval: interval}, zerolog.Nop())
+
+		done := make(chan struct{})
+		go func() {
+			manager.reconcileLoop(context.Background())
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("reconcileLoop() with update interval %v did not return", interval)
+		}
+	}
+}
+
+func TestManager_reconcileConcurrentEvents(t *testing.T) {
+	web := testListedContainer("web", "web.localhost", "172.17.0.2")
+
+	tests := []struct {
+		name        string
+		registered  bool   // Whether web is registered before reconciling
+		listed      bool   // Whether the container list includes web
+		duringList  string // Event handled while the containers are listed
+		duringCheck string // Event handled while web is inspected
+		wantTargets map[string][]string
+	}{
+		{
+			name:        "Success: Container started after the list was taken is kept",
+			listed:      false,
+			duringList:  "start",
+			wantTargets: map[string][]string{"web.localhost": {"http://172.17.0.2:80"}},
+		},
+		{
+			name:        "Success: Container stopped while being inspected is not registered",
+			listed:      true,
+			duringCheck: "die",
+			wantTargets: map[string][]string{},
+		},
+		{
+			name:        "Success: Container stopped after the list was taken stays unregistered",
+			registered:  true,
+			listed:      true,
+			duringList:  "die",
+			wantTargets: map[string][]string{},
+		},
+		{
+			name:        "Success: Container missing from the list is unregistered",
+			registered:  true,
+			listed:      false,
+			wantTargets: map[string][]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var manager *Manager
+			handle := func(action string) {
+				event := events.Message{Type: "container", Action: action, Actor: events.Actor{ID: web.ID}}
+				if err := manager.eventManager.HandleEvent(context.Background(), event); err != nil {
+					t.Errorf("HandleEvent(%s) error = %v", action, err)
+				}
+			}
+			webJSON := testContainerJSON(web.ID, web.Labels, "172.17.0.2")
+			reconciling := false
+			manager = NewManager(&mockManager{
+				ListContainersFn: func(_ context.Context) ([]types.Container, error) {
+					if reconciling && tt.duringList != "" {
+						handle(tt.duringList)
+					}
+					if tt.listed {
+						return []types.Container{web}, nil
+					}
+					return nil, nil
+				},
+				InspectContainerFn: func(_ context.Context, _ string) (types.ContainerJSON, error) {
+					if reconciling && tt.duringCheck != "" {
+						check := tt.duringCheck
+						tt.duringCheck = ""
+						handle(check)
+					}
+					return webJSON, nil
+				},
+			}, nil, zerolog.Nop())
+
+			if tt.registered {
+				handle("start")
+			}
+			reconciling = true
+			if err := manager.reconcile(context.Background()); err != nil {
+				t.Fatalf("reconcile() error = %v", err)
+			}
+
+			if got := routeTargets(manager); !reflect.DeepEqual(got, tt.wantTargets) {
+				t.Errorf("routes = %v, want %v", got, tt.wantTargets)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// shutdownPollInterval is how often Shutdown checks whether the open
+// connections have finished.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// ErrServerClosed is returned by Serve once the server has been shut down.
+var ErrServerClosed = errors.New("tcp: server closed")
+
+// connTracker keeps track of the listeners and proxied connections of a
+// server so they can be drained or closed on shutdown.
+type connTracker struct {
+	lock      sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// trackListener registers the listener and reports false when the server is
+// already shut down.
+func (t *connTracker) trackListener(l net.Listener) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		return false
+	}
+	t.listeners[l] = struct{}{}
+	return true
+}
+
+func (t *connTracker) untrackListener(l net.Listener) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.listeners, l)
+}
+
+func (t *connTracker) track(conn net.Conn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.conns[conn] = struct{}{}
+}
+
+func (t *connTracker) untrack(conn net.Conn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.conns, conn)
+}
+
+func (t *connTracker) count() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.conns)
+}
+
+func (t *connTracker) isClosed() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.closed
+}
+
+// closeListeners stops accepting new connections.
+func (t *connTracker) closeListeners() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.closed = true
+	for l := range t.listeners {
+		_ = l.Close()
+	}
+}
+
+// shutdown stops accepting new connections and waits for the open ones to
+// finish until the context is done.
+func (t *connTracker) shutdown(ctx context.Context) error {
+	t.closeListeners()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for t.count() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// close stops accepting new connections and closes the open ones.
+func (t *connTracker) close() error {
+	t.closeListeners()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for conn := range t.conns {
+		_ = conn.Close()
+	}
+	return nil
+}
+
+// pipe copies data between the client and the backend in both directions
+// until both sides are done, then closes both connections. A side that
+// finishes sending half-closes the other connection so protocols relying on
+// it keep working.
+func pipe(client, backend net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		copyAndCloseWrite(backend, client)
+	}()
+	go func() {
+		defer wg.Done()
+		copyAndCloseWrite(client, backend)
+	}()
+	wg.Wait()
+	_ = client.Close()
+	_ = backend.Close()
+}
+
+func copyAndCloseWrite(dst, src net.Conn) {
+	_, _ = io.Copy(dst, src)
+	if conn, ok := dst.(interface{ CloseWrite() error }); ok {
+		_ = conn.CloseWrite()
+	} else {
+		_ = dst.Close()
+	}
+}
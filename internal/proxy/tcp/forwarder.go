@@ -0,0 +1,225 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Networks a Port can be forwarded on.
+const (
+	NetworkTCP = "tcp"
+	NetworkUDP = "udp"
+)
+
+// Port is a port dockname listens on to forward traffic to backends.
+type Port struct {
+	Network string
+	Port    int
+}
+
+func (p Port) String() string {
+	return strconv.Itoa(p.Port) + "/" + p.Network
+}
+
+// Forwarder listens on ports while they have backends and forwards TCP
+// connections and UDP datagrams to the backends as they are.
+type Forwarder struct {
+	ports   map[Port]*forwardedPort
+	lock    sync.Mutex
+	closed  bool
+	dialer  net.Dialer
+	tracker *connTracker // TCP listeners and connections
+	logger  zerolog.Logger
+}
+
+type forwardedPort struct {
+	pool     *backendPool
+	listener net.Listener // Nil for UDP
+	relay    *udpRelay    // Nil for TCP
+}
+
+func NewForwarder(dialTimeout time.Duration, logger zerolog.Logger) *Forwarder {
+	return &Forwarder{
+		ports:   make(map[Port]*forwardedPort),
+		dialer:  net.Dialer{Timeout: dialTimeout},
+		tracker: newConnTracker(),
+		logger:  logger,
+	}
+}
+
+// AddBackend adds the backend to the pool of the port, listening on the port
+// if it has no backend yet. A backend with the same ID already in the pool is
+// replaced.
+func (f *Forwarder) AddBackend(port Port, backend *Backend) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.closed {
+		return ErrServerClosed
+	}
+	if forwarded, ok := f.ports[port]; ok {
+		forwarded.pool = forwarded.pool.with(backend)
+		return nil
+	}
+
+	forwarded := &forwardedPort{pool: (*backendPool)(nil).with(backend)}
+	addr := ":" + strconv.Itoa(port.Port)
+	switch port.Network {
+	case NetworkTCP:
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", port, err)
+		}
+		if !f.tracker.trackListener(listener) {
+			_ = listener.Close()
+			return ErrServerClosed
+		}
+		forwarded.listener = listener
+		go f.serveTCP(port, listener)
+	case NetworkUDP:
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", port, err)
+		}
+		forwarded.relay = newUDPRelay(f, port, conn)
+		go forwarded.relay.serve()
+	default:
+		return fmt.Errorf("unknown network: %s", port.Network)
+	}
+	f.ports[port] = forwarded
+
+	f.logger.Info().Str("port", port.String()).Msg("Listening for forwarded traffic")
+	return nil
+}
+
+// RemoveBackend removes the backend from the pool of the port and stops
+// listening on the port once its pool is empty. Open connections are left to
+// end on their own.
+func (f *Forwarder) RemoveBackend(port Port, backendID string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	forwarded, ok := f.ports[port]
+	if !ok {
+		return
+	}
+	if forwarded.pool = forwarded.pool.without(backendID); forwarded.pool != nil {
+		return
+	}
+
+	delete(f.ports, port)
+	if forwarded.listener != nil {
+		f.tracker.untrackListener(forwarded.listener)
+		_ = forwarded.listener.Close()
+	}
+	if forwarded.relay != nil {
+		forwarded.relay.close()
+	}
+	f.logger.Info().Str("port", port.String()).Msg("Stopped listening for forwarded traffic")
+}
+
+func (f *Forwarder) HasBackend(port Port, backendID string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	forwarded, ok := f.ports[port]
+	return ok && forwarded.pool.has(backendID)
+}
+
+// Backends returns the backends of the port.
+func (f *Forwarder) Backends(port Port) []*Backend {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	forwarded, ok := f.ports[port]
+	if !ok {
+		return nil
+	}
+	return forwarded.pool.list()
+}
+
+func (f *Forwarder) next(port Port) *Backend {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	forwarded, ok := f.ports[port]
+	if !ok {
+		return nil
+	}
+	return forwarded.pool.next()
+}
+
+func (f *Forwarder) serveTCP(port Port, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			if !errors.Is(err, net.ErrClosed) {
+				f.logger.Error().Err(err).Str("port", port.String()).Msg("failed to accept connection")
+			}
+			return
+		}
+		f.tracker.track(conn)
+		go f.serveConn(port, conn)
+	}
+}
+
+func (f *Forwarder) serveConn(port Port, conn net.Conn) {
+	defer f.tracker.untrack(conn)
+
+	logger := f.logger.With().Str("port", port.String()).Str("remote_addr", conn.RemoteAddr().String()).Logger()
+	backend := f.next(port)
+	if backend == nil {
+		logger.Debug().Msg("No backend for forwarded port, closing connection")
+		_ = conn.Close()
+		return
+	}
+
+	upstream, err := f.dialer.Dial("tcp", backend.Address)
+	if err != nil {
+		logger.Warn().Err(err).Str("backend", backend.Address).Msg("failed to connect to TCP backend")
+		_ = conn.Close()
+		return
+	}
+
+	logger.Debug().Str("backend", backend.Address).Msg("Forwarding TCP connection")
+	f.tracker.track(upstream)
+	defer f.tracker.untrack(upstream)
+	pipe(conn, upstream)
+}
+
+// Shutdown stops listening on every port and waits for the open TCP
+// connections to be closed by their clients or backends until the context is
+// done. UDP sessions are closed right away.
+func (f *Forwarder) Shutdown(ctx context.Context) error {
+	f.closeRelays()
+	return f.tracker.shutdown(ctx)
+}
+
+// Close stops listening on every port and closes the open connections.
+func (f *Forwarder) Close() error {
+	f.closeRelays()
+	return f.tracker.close()
+}
+
+func (f *Forwarder) closeRelays() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.closed = true
+	for _, forwarded := range f.ports {
+		if forwarded.relay != nil {
+			forwarded.relay.close()
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// startTCPEcho starts a TCP server that prefixes every line with its name.
+func startTCPEcho(t *testing.T, name string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					_, _ = io.WriteString(conn, name+" "+scanner.Text()+"\n")
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// startUDPEcho starts a UDP server that prefixes every datagram with its name.
+func startUDPEcho(t *testing.T, name string) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.WriteTo([]byte(name+" "+string(buf[:n])), addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// freePort returns a local port nothing listens on.
+func freePort(t *testing.T, network string) Port {
+	t.Helper()
+	var addr net.Addr
+	switch network {
+	case NetworkTCP:
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		addr = listener.Addr()
+		_ = listener.Close()
+	case NetworkUDP:
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		addr = conn.LocalAddr()
+		_ = conn.Close()
+	}
+	_, port, _ := net.SplitHostPort(addr.String())
+	n, _ := strconv.Atoi(port)
+	return Port{Network: network, Port: n}
+}
+
+// exchange sends a message on a new connection to the port and returns the
+// answer.
+func exchange(port Port, message string) (string, error) {
+	conn, err := net.Dial(port.Network, "127.0.0.1:"+strconv.Itoa(port.Port))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if port.Network == NetworkUDP {
+		if _, err := conn.Write([]byte(message)); err != nil {
+			return "", err
+		}
+		buf := make([]byte, maxDatagramSize)
+		n, err := conn.Read(buf)
+		return string(buf[:n]), err
+	}
+	if _, err := io.WriteString(conn, message+"\n"); err != nil {
+		return "", err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	return strings.TrimSuffix(line, "\n"), err
+}
+
+func TestForwarder(t *testing.T) {
+	tcp1, tcp2 := startTCPEcho(t, "tcp1"), startTCPEcho(t, "tcp2")
+	udp1, udp2 := startUDPEcho(t, "udp1"), startUDPEcho(t, "udp2")
+
+	tests := []struct {
+		name    string
+		network string
+		setup   func(f *Forwarder, port Port) error
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "Success: TCP connections are forwarded",
+			network: NetworkTCP,
+			setup: func(f *Forwarder, port Port) error {
+				return f.AddBackend(port, &Backend{ID: "tcp1", Address: tcp1})
+			},
+			want: []string{"tcp1 ping", "tcp1 ping"},
+		},
+		{
+			name:    "Success: TCP connections are balanced across backends",
+			network: NetworkTCP,
+			setup: func(f *Forwarder, port Port) error {
+				if err := f.AddBackend(port, &Backend{ID: "tcp1", Address: tcp1}); err != nil {
+					return err
+				}
+				return f.AddBackend(port, &Backend{ID: "tcp2", Address: tcp2})
+			},
+			want: []string{"tcp1 ping", "tcp2 ping", "tcp1 ping"},
+		},
+		{
+			name:    "Success: UDP datagrams are forwarded per client",
+			network: NetworkUDP,
+			setup: func(f *Forwarder, port Port) error {
+				if err := f.AddBackend(port, &Backend{ID: "udp1", Address: udp1}); err != nil {
+					return err
+				}
+				return f.AddBackend(port, &Backend{ID: "udp2", Address: udp2})
+			},
+			want: []string{"udp1 ping", "udp2 ping", "udp1 ping"},
+		},
+		{
+			name:    "Success: Remaining backend keeps the port open",
+			network: NetworkTCP,
+			setup: func(f *Forwarder, port Port) error {
+				if err := f.AddBackend(port, &Backend{ID: "tcp1", Address: tcp1}); err != nil {
+					return err
+				}
+				if err := f.AddBackend(port, &Backend{ID: "tcp2", Address: tcp2}); err != nil {
+					return err
+				}
+				f.RemoveBackend(port, "tcp1")
+				return nil
+			},
+			want: []string{"tcp2 ping", "tcp2 ping"},
+		},
+		{
+			name:    "Error: Port is closed with its last backend",
+			network: NetworkTCP,
+			setup: func(f *Forwarder, port Port) error {
+				if err := f.AddBackend(port, &Backend{ID: "tcp1", Address: tcp1}); err != nil {
+					return err
+				}
+				f.RemoveBackend(port, "tcp1")
+				return nil
+			},
+			wantErr: true,
+		},
+		{
+			name:    "Error: UDP port is closed with its last backend",
+			network: NetworkUDP,
+			setup: func(f *Forwarder, port Port) error {
+				if err := f.AddBackend(port, &Backend{ID: "udp1", Address: udp1}); err != nil {
+					return err
+				}
+				f.RemoveBackend(port, "udp1")
+				return nil
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarder := NewForwarder(time.Second, zerolog.Nop())
+			defer forwarder.Close()
+			port := freePort(t, tt.network)
+			if err := tt.setup(forwarder, port); err != nil {
+				t.Fatalf("setup error = %v", err)
+			}
+
+			if tt.wantErr {
+				if got, err := exchange(port, "ping"); err == nil {
+					t.Fatalf("exchange() = %q, want an error", got)
+				}
+				return
+			}
+			for i, want := range tt.want {
+				got, err := exchange(port, "ping")
+				if err != nil {
+					t.Fatalf("exchange %d error = %v", i, err)
+				}
+				if got != want {
+					t.Errorf("exchange %d = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestForwarder_AddBackend(t *testing.T) {
+	forwarder := NewForwarder(time.Second, zerolog.Nop())
+	defer forwarder.Close()
+
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer busy.Close()
+	busyPort := Port{Network: NetworkTCP, Port: busy.Addr().(*net.TCPAddr).Port}
+	if err := forwarder.AddBackend(busyPort, &Backend{ID: "db", Address: "127.0.0.1:5432"}); err == nil {
+		t.Error("AddBackend() on a port in use succeeded, want an error")
+	}
+	if forwarder.HasBackend(busyPort, "db") {
+		t.Error("HasBackend() = true for a port that failed to open")
+	}
+
+	port := freePort(t, NetworkTCP)
+	if err := forwarder.AddBackend(port, &Backend{ID: "db", Address: "127.0.0.1:5432"}); err != nil {
+		t.Fatalf("AddBackend() error = %v", err)
+	}
+	if err := forwarder.AddBackend(port, &Backend{ID: "db", Address: "127.0.0.1:5433"}); err != nil {
+		t.Fatalf("AddBackend() of a replaced backend error = %v", err)
+	}
+	if backends := forwarder.Backends(port); len(backends) != 1 || backends[0].Address != "127.0.0.1:5433" {
+		t.Errorf("Backends() = %+v, want the replaced backend only", backends)
+	}
+}
+
+func TestForwarder_Shutdown(t *testing.T) {
+	forwarder := NewForwarder(time.Second, zerolog.Nop())
+	port := freePort(t, NetworkTCP)
+	if err := forwarder.AddBackend(port, &Backend{ID: "tcp1", Address: startTCPEcho(t, "tcp1")}); err != nil {
+		t.Fatalf("AddBackend() error = %v", err)
+	}
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port.Port))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "ping\n"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := forwarder.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() with an open connection error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := exchange(port, "ping"); err == nil {
+		t.Error("forwarder still accepts connections after Shutdown")
+	}
+	if err := forwarder.AddBackend(freePort(t, NetworkUDP), &Backend{ID: "udp1"}); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("AddBackend() after Shutdown error = %v, want %v", err, ErrServerClosed)
+	}
+
+	if err := forwarder.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Errorf("Read() after Close error = %v, want the connection closed", err)
+	}
+}
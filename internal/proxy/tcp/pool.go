@@ -0,0 +1,79 @@
+package tcp
+
+import "sync/atomic"
+
+// Backend is a container port that raw TCP connections are forwarded to.
+type Backend struct {
+	ID            string
+	ContainerName string
+	Address       string // host:port
+}
+
+// backendPool is an immutable set of backends picked in round-robin order.
+// Adding or removing a backend returns a new pool sharing the counter, so a
+// pool can be used without holding the lock of the table it is stored in.
+type backendPool struct {
+	backends []*Backend
+	counter  *uint64
+}
+
+// with returns the pool with the backend added, replacing a backend with the
+// same ID. The receiver may be nil.
+func (p *backendPool) with(backend *Backend) *backendPool {
+	pool := &backendPool{counter: new(uint64)}
+	if p != nil {
+		pool.counter = p.counter
+		for _, b := range p.backends {
+			if b.ID != backend.ID {
+				pool.backends = append(pool.backends, b)
+			}
+		}
+	}
+	pool.backends = append(pool.backends, backend)
+	return pool
+}
+
+// without returns the pool with the backend removed, or nil once it is empty.
+func (p *backendPool) without(backendID string) *backendPool {
+	if p == nil {
+		return nil
+	}
+	pool := &backendPool{counter: p.counter}
+	for _, b := range p.backends {
+		if b.ID != backendID {
+			pool.backends = append(pool.backends, b)
+		}
+	}
+	if len(pool.backends) == 0 {
+		return nil
+	}
+	return pool
+}
+
+func (p *backendPool) has(backendID string) bool {
+	if p == nil {
+		return false
+	}
+	for _, b := range p.backends {
+		if b.ID == backendID {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *backendPool) list() []*Backend {
+	if p == nil {
+		return nil
+	}
+	return append([]*Backend(nil), p.backends...)
+}
+
+// next picks the next backend, or nil when the pool is empty.
+func (p *backendPool) next() *Backend {
+	if p == nil || len(p.backends) == 0 {
+		return nil
+	}
+	n := atomic.AddUint64(p.counter, 1)
+	return p.backends[(n-1)%uint64(len(p.backends))]
+}
@@ -0,0 +1,52 @@
+package tcp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+var errClientHelloRead = errors.New("client hello read")
+
+// peekServerName reads the TLS ClientHello from the connection and returns
+// the server name the client asked for along with every byte read, which has
+// to be replayed to the backend. The handshake itself is left to the backend.
+func peekServerName(conn net.Conn) (string, []byte, error) {
+	var peeked bytes.Buffer
+	var serverName string
+	var sawHello bool
+	err := tls.Server(readOnlyConn{reader: io.TeeReader(conn, &peeked)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			sawHello = true
+			return nil, errClientHelloRead
+		},
+	}).Handshake()
+	if !sawHello {
+		return "", peeked.Bytes(), err
+	}
+	return normalizeHost(serverName), peeked.Bytes(), nil
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// readOnlyConn lets crypto/tls parse a ClientHello without being able to
+// answer it.
+type readOnlyConn struct {
+	reader io.Reader
+}
+
+func (c readOnlyConn) Read(p []byte) (int, error)       { return c.reader.Read(p) }
+func (c readOnlyConn) Write([]byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (c readOnlyConn) Close() error                     { return nil }
+func (c readOnlyConn) LocalAddr() net.Addr              { return nil }
+func (c readOnlyConn) RemoteAddr() net.Addr             { return nil }
+func (c readOnlyConn) SetDeadline(time.Time) error      { return nil }
+func (c readOnlyConn) SetReadDeadline(time.Time) error  { return nil }
+func (c readOnlyConn) SetWriteDeadline(time.Time) error { return nil }
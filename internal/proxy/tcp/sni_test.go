@@ -0,0 +1,85 @@
+package tcp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+func TestPeekServerName(t *testing.T) {
+	tests := []struct {
+		name       string
+		send       func(conn net.Conn)
+		want       string
+		wantErr    bool
+		wantPeeked bool
+	}{
+		{
+			name: "Success: Server name of the ClientHello",
+			send: func(conn net.Conn) {
+				_ = tls.Client(conn, &tls.Config{ServerName: "DB.localhost."}).Handshake()
+			},
+			want:       "db.localhost",
+			wantPeeked: true,
+		},
+		{
+			name: "Success: ClientHello without server name",
+			send: func(conn net.Conn) {
+				_ = tls.Client(conn, &tls.Config{InsecureSkipVerify: true}).Handshake()
+			},
+			want:       "",
+			wantPeeked: true,
+		},
+		{
+			name: "Error: Plain text client",
+			send: func(conn net.Conn) {
+				_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: db.localhost\r\n\r\n"))
+				_ = conn.Close()
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			var sent bytes.Buffer
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				tt.send(&recordingConn{Conn: client, written: &sent})
+			}()
+
+			got, peeked, err := peekServerName(server)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("peekServerName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("peekServerName() = %q, want %q", got, tt.want)
+			}
+			// The ClientHello is the only message the client sends before
+			// waiting for an answer, so every byte of it must be replayed.
+			_ = server.Close()
+			<-done
+			if tt.wantPeeked && !bytes.Equal(peeked, sent.Bytes()) {
+				t.Errorf("peekServerName() peeked %d bytes, want the %d bytes sent", len(peeked), sent.Len())
+			}
+		})
+	}
+}
+
+// recordingConn records what the client writes.
+type recordingConn struct {
+	net.Conn
+	written *bytes.Buffer
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Write(p[:n])
+	return n, err
+}
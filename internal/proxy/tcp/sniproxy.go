@@ -0,0 +1,178 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// clientHelloTimeout is how long a client may take to send its TLS
+// ClientHello before the connection is closed.
+const clientHelloTimeout = 10 * time.Second
+
+// SNIProxy forwards TLS connections to backends by the server name of the
+// ClientHello without terminating TLS, so the backends present their own
+// certificates to the clients.
+type SNIProxy struct {
+	routes     map[string]*backendPool
+	routesLock sync.RWMutex
+	dialer     net.Dialer
+	tracker    *connTracker
+	logger     zerolog.Logger
+}
+
+func NewSNIProxy(dialTimeout time.Duration, logger zerolog.Logger) *SNIProxy {
+	return &SNIProxy{
+		routes:  make(map[string]*backendPool),
+		dialer:  net.Dialer{Timeout: dialTimeout},
+		tracker: newConnTracker(),
+		logger:  logger,
+	}
+}
+
+// AddBackend adds the backend to the pool of the host. A backend with the
+// same ID already in the pool is replaced.
+func (p *SNIProxy) AddBackend(host string, backend *Backend) {
+	host = normalizeHost(host)
+
+	p.routesLock.Lock()
+	defer p.routesLock.Unlock()
+	p.routes[host] = p.routes[host].with(backend)
+}
+
+// RemoveBackend removes the backend from the pool of the host and drops the
+// host once its pool is empty.
+func (p *SNIProxy) RemoveBackend(host, backendID string) {
+	host = normalizeHost(host)
+
+	p.routesLock.Lock()
+	defer p.routesLock.Unlock()
+	if pool := p.routes[host].without(backendID); pool != nil {
+		p.routes[host] = pool
+	} else {
+		delete(p.routes, host)
+	}
+}
+
+func (p *SNIProxy) HasBackend(host, backendID string) bool {
+	p.routesLock.RLock()
+	defer p.routesLock.RUnlock()
+	return p.routes[normalizeHost(host)].has(backendID)
+}
+
+// Hosts returns the routed server names in alphabetical order.
+func (p *SNIProxy) Hosts() []string {
+	p.routesLock.RLock()
+	defer p.routesLock.RUnlock()
+
+	hosts := make([]string, 0, len(p.routes))
+	for host := range p.routes {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Backends returns the backends of the host.
+func (p *SNIProxy) Backends(host string) []*Backend {
+	p.routesLock.RLock()
+	defer p.routesLock.RUnlock()
+	return p.routes[normalizeHost(host)].list()
+}
+
+func (p *SNIProxy) next(host string) *Backend {
+	p.routesLock.RLock()
+	defer p.routesLock.RUnlock()
+	return p.routes[host].next()
+}
+
+// ListenAndServe listens on the TCP address and serves connections until the
+// proxy is shut down.
+func (p *SNIProxy) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(listener)
+}
+
+// Serve accepts connections on the listener until the proxy is shut down, in
+// which case it returns ErrServerClosed.
+func (p *SNIProxy) Serve(listener net.Listener) error {
+	if !p.tracker.trackListener(listener) {
+		_ = listener.Close()
+		return ErrServerClosed
+	}
+	defer p.tracker.untrackListener(listener)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if p.tracker.isClosed() {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		p.tracker.track(conn)
+		go p.serveConn(conn)
+	}
+}
+
+func (p *SNIProxy) serveConn(conn net.Conn) {
+	defer p.tracker.untrack(conn)
+
+	_ = conn.SetReadDeadline(time.Now().Add(clientHelloTimeout))
+	serverName, peeked, err := peekServerName(conn)
+	_ = conn.SetReadDeadline(time.Time{})
+	logger := p.logger.With().Str("remote_addr", conn.RemoteAddr().String()).Str("server_name", serverName).Logger()
+	if err != nil {
+		logger.Debug().Err(err).Msg("Failed to read TLS ClientHello, closing connection")
+		_ = conn.Close()
+		return
+	}
+
+	backend := p.next(serverName)
+	if backend == nil {
+		logger.Debug().Msg("TCP route not found, closing connection")
+		_ = conn.Close()
+		return
+	}
+
+	upstream, err := p.dialer.Dial("tcp", backend.Address)
+	if err != nil {
+		logger.Warn().Err(err).Str("backend", backend.Address).Msg("failed to connect to TCP backend")
+		_ = conn.Close()
+		return
+	}
+	if _, err := upstream.Write(peeked); err != nil {
+		logger.Warn().Err(err).Str("backend", backend.Address).Msg("failed to forward TLS ClientHello")
+		_ = conn.Close()
+		_ = upstream.Close()
+		return
+	}
+
+	logger.Debug().Str("backend", backend.Address).Msg("Forwarding TCP connection")
+	p.tracker.track(upstream)
+	defer p.tracker.untrack(upstream)
+	pipe(conn, upstream)
+}
+
+// Shutdown stops accepting connections and waits for the open ones to be
+// closed by their clients or backends until the context is done.
+func (p *SNIProxy) Shutdown(ctx context.Context) error {
+	return p.tracker.shutdown(ctx)
+}
+
+// Close stops accepting connections and closes the open ones.
+func (p *SNIProxy) Close() error {
+	return p.tracker.close()
+}
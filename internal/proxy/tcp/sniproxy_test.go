@@ -0,0 +1,230 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// newTLSBackend starts a TLS server answering with its name and the server
+// name the client asked for.
+func newTLSBackend(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, name+" "+r.TLS.ServerName)
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// startSNIProxy serves the proxy on a random local port and returns its
+// address along with the result of Serve.
+func startSNIProxy(t *testing.T, proxy *SNIProxy) (string, <-chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- proxy.Serve(listener)
+	}()
+	t.Cleanup(func() { _ = proxy.Close() })
+	return listener.Addr().String(), serveErr
+}
+
+// getThroughProxy sends an HTTPS request for the server name through the
+// proxy on a new connection.
+func getThroughProxy(proxyAddr, serverName string) (string, error) {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, proxyAddr)
+			},
+			TLSClientConfig:   &tls.Config{ServerName: serverName, InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+	}
+	resp, err := client.Get("https://" + serverName + "/")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestSNIProxy_Routing(t *testing.T) {
+	db1 := newTLSBackend(t, "db1")
+	db2 := newTLSBackend(t, "db2")
+	cache := newTLSBackend(t, "cache")
+
+	tests := []struct {
+		name       string
+		setup      func(p *SNIProxy)
+		serverName string
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name: "Success: Connection forwarded by server name",
+			setup: func(p *SNIProxy) {
+				p.AddBackend("db.localhost", &Backend{ID: "db1", Address: db1.Listener.Addr().String()})
+				p.AddBackend("cache.localhost", &Backend{ID: "cache", Address: cache.Listener.Addr().String()})
+			},
+			serverName: "cache.localhost",
+			want:       []string{"cache cache.localhost", "cache cache.localhost"},
+		},
+		{
+			name: "Success: Connections balanced across backends",
+			setup: func(p *SNIProxy) {
+				p.AddBackend("db.localhost", &Backend{ID: "db1", Address: db1.Listener.Addr().String()})
+				p.AddBackend("DB.localhost", &Backend{ID: "db2", Address: db2.Listener.Addr().String()})
+			},
+			serverName: "db.localhost",
+			want:       []string{"db1 db.localhost", "db2 db.localhost", "db1 db.localhost"},
+		},
+		{
+			name: "Success: Backend with the same ID is replaced",
+			setup: func(p *SNIProxy) {
+				p.AddBackend("db.localhost", &Backend{ID: "db", Address: db1.Listener.Addr().String()})
+				p.AddBackend("db.localhost", &Backend{ID: "db", Address: db2.Listener.Addr().String()})
+			},
+			serverName: "db.localhost",
+			want:       []string{"db2 db.localhost", "db2 db.localhost"},
+		},
+		{
+			name: "Error: Unknown server name",
+			setup: func(p *SNIProxy) {
+				p.AddBackend("db.localhost", &Backend{ID: "db1", Address: db1.Listener.Addr().String()})
+			},
+			serverName: "other.localhost",
+			wantErr:    true,
+		},
+		{
+			name: "Error: Removed backend",
+			setup: func(p *SNIProxy) {
+				p.AddBackend("db.localhost", &Backend{ID: "db1", Address: db1.Listener.Addr().String()})
+				p.RemoveBackend("db.localhost", "db1")
+			},
+			serverName: "db.localhost",
+			wantErr:    true,
+		},
+		{
+			name: "Error: Backend not reachable",
+			setup: func(p *SNIProxy) {
+				p.AddBackend("db.localhost", &Backend{ID: "db1", Address: closedAddr(t)})
+			},
+			serverName: "db.localhost",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := NewSNIProxy(time.Second, zerolog.Nop())
+			tt.setup(proxy)
+			addr, _ := startSNIProxy(t, proxy)
+
+			if tt.wantErr {
+				if body, err := getThroughProxy(addr, tt.serverName); err == nil {
+					t.Fatalf("request succeeded with %q, want an error", body)
+				}
+				return
+			}
+			for i, want := range tt.want {
+				got, err := getThroughProxy(addr, tt.serverName)
+				if err != nil {
+					t.Fatalf("request %d error = %v", i, err)
+				}
+				if got != want {
+					t.Errorf("request %d = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSNIProxy_Backends(t *testing.T) {
+	proxy := NewSNIProxy(time.Second, zerolog.Nop())
+	proxy.AddBackend("db.localhost.", &Backend{ID: "db1", Address: "172.17.0.2:5432"})
+	proxy.AddBackend("cache.localhost", &Backend{ID: "cache", Address: "172.17.0.3:6379"})
+
+	if !proxy.HasBackend("DB.localhost", "db1") {
+		t.Error("HasBackend(db.localhost, db1) = false, want true")
+	}
+	if proxy.HasBackend("db.localhost", "cache") {
+		t.Error("HasBackend(db.localhost, cache) = true, want false")
+	}
+	if got, want := strings.Join(proxy.Hosts(), ","), "cache.localhost,db.localhost"; got != want {
+		t.Errorf("Hosts() = %v, want %v", got, want)
+	}
+
+	proxy.RemoveBackend("db.localhost", "db1")
+	if got, want := strings.Join(proxy.Hosts(), ","), "cache.localhost"; got != want {
+		t.Errorf("Hosts() after RemoveBackend = %v, want %v", got, want)
+	}
+}
+
+func TestSNIProxy_Shutdown(t *testing.T) {
+	backend := newTLSBackend(t, "db")
+	proxy := NewSNIProxy(time.Second, zerolog.Nop())
+	proxy.AddBackend("db.localhost", &Backend{ID: "db", Address: backend.Listener.Addr().String()})
+	addr, serveErr := startSNIProxy(t, proxy)
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: "db.localhost", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Failed to connect through the proxy: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := proxy.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() with an open connection error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := <-serveErr; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Serve() error = %v, want %v", err, ErrServerClosed)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("proxy still accepts connections after Shutdown")
+	}
+
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Errorf("Read() after Close error = %v, want the connection closed", err)
+	}
+	if err := proxy.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() after Close error = %v", err)
+	}
+}
+
+// closedAddr returns a local address nothing listens on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+	return addr
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
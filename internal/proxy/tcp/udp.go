@@ -0,0 +1,163 @@
+package tcp
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// udpSessionTimeout is how long a UDP session is kept without datagrams in
+// either direction.
+const udpSessionTimeout = time.Minute
+
+// maxDatagramSize is the largest UDP payload.
+const maxDatagramSize = 65535
+
+// udpRelay forwards the datagrams received on a port. Each client address
+// gets its own session with a connected socket to a backend, so replies find
+// their way back to the client that sent the request.
+type udpRelay struct {
+	forwarder *Forwarder
+	port      Port
+	conn      net.PacketConn
+
+	lock     sync.Mutex
+	sessions map[string]*udpSession
+	closed   bool
+}
+
+type udpSession struct {
+	backend    net.Conn
+	lastActive int64 // Unix nanoseconds of the last datagram
+}
+
+func (s *udpSession) touch() {
+	atomic.StoreInt64(&s.lastActive, time.Now().UnixNano())
+}
+
+func (s *udpSession) idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&s.lastActive)))
+}
+
+func newUDPRelay(forwarder *Forwarder, port Port, conn net.PacketConn) *udpRelay {
+	return &udpRelay{
+		forwarder: forwarder,
+		port:      port,
+		conn:      conn,
+		sessions:  make(map[string]*udpSession),
+	}
+}
+
+func (r *udpRelay) serve() {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			r.forwarder.logger.Debug().Err(err).Str("port", r.port.String()).Msg("failed to read datagram")
+			continue
+		}
+
+		session := r.session(addr)
+		if session == nil {
+			continue
+		}
+		session.touch()
+		if _, err := session.backend.Write(buf[:n]); err != nil {
+			r.forwarder.logger.Debug().Err(err).Str("port", r.port.String()).Msg("failed to forward datagram")
+		}
+	}
+}
+
+// session returns the session of the client, connecting a new one to the
+// next backend if needed. Sessions are only created by serve, so the relay is
+// not locked while the backend is picked, which locks the forwarder.
+func (r *udpRelay) session(addr net.Addr) *udpSession {
+	r.lock.Lock()
+	session, ok := r.sessions[addr.String()]
+	r.lock.Unlock()
+	if ok {
+		return session
+	}
+
+	logger := r.forwarder.logger.With().Str("port", r.port.String()).Str("remote_addr", addr.String()).Logger()
+	backend := r.forwarder.next(r.port)
+	if backend == nil {
+		logger.Debug().Msg("No backend for forwarded port, dropping datagram")
+		return nil
+	}
+	conn, err := r.forwarder.dialer.Dial("udp", backend.Address)
+	if err != nil {
+		logger.Warn().Err(err).Str("backend", backend.Address).Msg("failed to connect to UDP backend")
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		_ = conn.Close()
+		return nil
+	}
+	logger.Debug().Str("backend", backend.Address).Msg("Forwarding UDP session")
+	session = &udpSession{backend: conn}
+	session.touch()
+	r.sessions[addr.String()] = session
+	go r.reply(addr, session)
+	return session
+}
+
+// reply sends the datagrams of the backend back to the client until the
+// session is idle for udpSessionTimeout or the relay is closed.
+func (r *udpRelay) reply(addr net.Addr, session *udpSession) {
+	defer r.endSession(addr, session)
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		_ = session.backend.SetReadDeadline(time.Now().Add(udpSessionTimeout - session.idle()))
+		n, err := session.backend.Read(buf)
+		if err != nil {
+			// The deadline is pushed back by datagrams from the client, and a
+			// datagram refused by the backend is reported on the next read
+			// without ending the session.
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && session.idle() < udpSessionTimeout {
+				continue
+			}
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				continue
+			}
+			return
+		}
+		session.touch()
+		if _, err := r.conn.WriteTo(buf[:n], addr); err != nil {
+			return
+		}
+	}
+}
+
+func (r *udpRelay) endSession(addr net.Addr, session *udpSession) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.sessions[addr.String()] == session {
+		delete(r.sessions, addr.String())
+	}
+	_ = session.backend.Close()
+}
+
+// close stops listening on the port and ends every session.
+func (r *udpRelay) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.closed = true
+	_ = r.conn.Close()
+	for _, session := range r.sessions {
+		_ = session.backend.Close()
+	}
+}
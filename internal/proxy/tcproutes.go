@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/kiwamizamurai/dockname/internal/proxy/tcp"
+)
+
+// TCP options, set as dockname.tcp.<option>. The domain and port route TLS
+// connections on the tcp_port listener by server name without terminating
+// TLS, while listen forwards host ports.
+const (
+	tcpService      = "tcp"
+	optionTCPDomain = "tcp.domain"
+	optionTCPPort   = "tcp.port"
+	optionTCPListen = "tcp.listen"
+	optionUDPListen = "udp.listen"
+)
+
+// tcpRouteSpec is a TLS service of a container reached through the SNI proxy.
+type tcpRouteSpec struct {
+	Domains []string
+	Port    string // Empty to detect it from the exposed ports
+	Network string
+}
+
+// containerRoutes holds everything a container asks dockname to route.
+type containerRoutes struct {
+	http     []routeSpec
+	tcp      *tcpRouteSpec
+	forwards []forwardSpec
+	// listedAt is the generation of the reconciliation that found the
+	// container running, zero outside reconciliation
+	listedAt uint64
+}
+
+func (r containerRoutes) empty() bool {
+	return len(r.http) == 0 && r.tcp == nil && len(r.forwards) == 0
+}
+
+// parseTCPLabels returns the TLS passthrough route declared by
+// dockname.tcp.domain. Containers are reached on the dockname.network network
+// like their HTTP services.
+func parseTCPLabels(labels map[string]string) (*tcpRouteSpec, bool) {
+	domains := splitDomains(labels[labelPrefix+optionTCPDomain])
+	if len(domains) == 0 {
+		return nil, false
+	}
+	return &tcpRouteSpec{
+		Domains: domains,
+		Port:    labels[labelPrefix+optionTCPPort],
+		Network: labels[labelPrefix+optionNetwork],
+	}, true
+}
+
+// containerRoutes returns the HTTP, TCP and forwarded port routes of a
+// container.
+func (m *Manager) containerRoutes(container types.Container) containerRoutes {
+	if enabled, err := strconv.ParseBool(container.Labels[labelEnable]); err == nil && !enabled {
+		return containerRoutes{}
+	}
+	routes := containerRoutes{http: m.routeSpecs(container)}
+	if spec, ok := parseTCPLabels(container.Labels); ok {
+		routes.tcp = spec
+	}
+	routes.forwards = parseForwardLabels(container.Labels)
+	return routes
+}
+
+// addTCPRoutes adds the container as a backend of the SNI proxy on each of
+// its TCP domains and returns the domains it was added on. It must be called
+// with containersLock held.
+func (m *Manager) addTCPRoutes(container types.Container, containerJSON types.ContainerJSON, spec tcpRouteSpec) ([]string, error) {
+	if m.sniProxy == nil {
+		m.logger.Warn().
+			Str("container_id", container.ID).
+			Strs("domains", spec.Domains).
+			Msg("TCP routing is disabled, set tcp_port to route dockname.tcp.domain")
+		return nil, nil
+	}
+
+	networkName, containerIP, err := selectNetwork(containerJSON.NetworkSettings.Networks, spec.Network, m.config.Network, m.ownNetworks)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, container.ID)
+	}
+
+	port := spec.Port
+	if port == "" {
+		// Prefer the usual TLS ports and report ambiguity as dockname.tcp.port
+		port = m.detectPort(container, containerJSON, routeSpec{Service: tcpService, Scheme: schemeHTTPS})
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return nil, fmt.Errorf("invalid TCP port %q: %s", port, container.ID)
+	}
+
+	backend := &tcp.Backend{
+		ID:            container.ID,
+		ContainerName: containerName(container),
+		Address:       net.JoinHostPort(containerIP, port),
+	}
+	var errs []error
+	var hosts []string
+	for _, domain := range spec.Domains {
+		if strings.ContainsAny(domain, "*~") {
+			errs = append(errs, fmt.Errorf("TCP domain %s must be an exact host: %s", domain, container.ID))
+			continue
+		}
+		m.sniProxy.AddBackend(domain, backend)
+		hosts = append(hosts, domain)
+
+		m.logger.Info().
+			Str("container_id", container.ID).
+			Str("network", networkName).
+			Str("domain", domain).
+			Str("target", backend.Address).
+			Msg("Registered container for TCP")
+	}
+	return hosts, errors.Join(errs...)
+}
+
+func (m *Manager) removeTCPRoute(containerID, host string) {
+	m.sniProxy.RemoveBackend(host, containerID)
+
+	m.logger.Info().
+		Str("container_id", containerID).
+		Str("domain", host).
+		Msg("Unregistered container for TCP")
+}
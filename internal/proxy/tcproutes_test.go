@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/go-connections/nat"
+	"github.com/rs/zerolog"
+)
+
+func TestParseTCPLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   *tcpRouteSpec
+	}{
+		{
+			name: "Success: Domains, port and network are parsed",
+			labels: map[string]string{
+				"dockname.tcp.domain": "db.localhost, replica.db.localhost",
+				"dockname.tcp.port":   "5432",
+				"dockname.network":    "backend",
+			},
+			want: &tcpRouteSpec{Domains: []string{"db.localhost", "replica.db.localhost"}, Port: "5432", Network: "backend"},
+		},
+		{
+			name:   "Success: Port is detected when not set",
+			labels: map[string]string{"dockname.tcp.domain": "redis.localhost"},
+			want:   &tcpRouteSpec{Domains: []string{"redis.localhost"}},
+		},
+		{
+			name:   "Error: Empty domain list",
+			labels: map[string]string{"dockname.tcp.domain": " , "},
+			want:   nil,
+		},
+		{
+			name:   "Error: HTTP domain only",
+			labels: map[string]string{"dockname.domain": "app.localhost", "dockname.tcp.port": "5432"},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := parseTCPLabels(tt.labels); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTCPLabels() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_TCPRoutes(t *testing.T) {
+	containers := map[string]types.ContainerJSON{
+		"postgres": testContainerJSON("postgres", map[string]string{
+			"dockname.tcp.domain": "db.localhost,pg.localhost",
+		}, "172.17.0.2"),
+		"redis": testContainerJSON("redis", map[string]string{
+			"dockname.domain":     "redis-ui.localhost",
+			"dockname.tcp.domain": "redis.localhost",
+			"dockname.tcp.port":   "6380",
+		}, "172.17.0.3"),
+		"wildcard": testContainerJSON("wildcard", map[string]string{
+			"dockname.tcp.domain": "*.db.localhost",
+		}, "172.17.0.4"),
+		"disabled": testContainerJSON("disabled", map[string]string{
+			"dockname.enable":     "false",
+			"dockname.tcp.domain": "db.localhost",
+		}, "172.17.0.5"),
+	}
+	containers["postgres"].Config.ExposedPorts = nat.PortSet{"5432/tcp": {}}
+
+	tests := []struct {
+		name     string
+		tcpPort  string
+		events   []events.Message
+		want     map[string]string // Host to backend address
+		wantHTTP []string
+		wantErr  bool
+	}{
+		{
+			name:    "Success: Container with only TCP labels is routed on the detected port",
+			tcpPort: ":0",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "postgres"}},
+			},
+			want: map[string]string{"db.localhost": "172.17.0.2:5432", "pg.localhost": "172.17.0.2:5432"},
+		},
+		{
+			name:    "Success: HTTP and TCP routes of a container",
+			tcpPort: ":0",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "redis"}},
+			},
+			want:     map[string]string{"redis.localhost": "172.17.0.3:6380"},
+			wantHTTP: []string{"redis-ui.localhost"},
+		},
+		{
+			name:    "Success: Stop event removes TCP routes",
+			tcpPort: ":0",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "postgres"}},
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "redis"}},
+				{Type: "container", Action: "die", Actor: events.Actor{ID: "postgres"}},
+			},
+			want:     map[string]string{"redis.localhost": "172.17.0.3:6380"},
+			wantHTTP: []string{"redis-ui.localhost"},
+		},
+		{
+			name:    "Success: Disabled container is skipped",
+			tcpPort: ":0",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "disabled"}},
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "Success: TCP labels are ignored without tcp_port",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "redis"}},
+			},
+			wantHTTP: []string{"redis-ui.localhost"},
+		},
+		{
+			name:    "Error: Wildcard TCP domain",
+			tcpPort: ":0",
+			events: []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{ID: "wildcard"}},
+			},
+			want:    map[string]string{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockManager := &mockManager{
+				InspectContainerFn: func(_ context.Context, containerID string) (types.ContainerJSON, error) {
+					return containers[containerID], nil
+				},
+			}
+			config := DefaultConfig()
+			config.TCPPort = tt.tcpPort
+			manager := NewManager(mockManager, config, zerolog.Nop())
+
+			var err error
+			for _, event := range tt.events {
+				if handleErr := manager.eventManager.HandleEvent(context.Background(), event); handleErr != nil {
+					err = handleErr
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HandleEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if manager.sniProxy == nil {
+				if tt.want != nil {
+					t.Fatal("SNI proxy not created")
+				}
+			} else {
+				got := make(map[string]string)
+				for _, host := range manager.sniProxy.Hosts() {
+					got[host] = manager.sniProxy.Backends(host)[0].Address
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("TCP routes = %v, want %v", got, tt.want)
+				}
+			}
+
+			var gotHTTP []string
+			for _, route := range manager.proxyHandler.GetRoutes() {
+				gotHTTP = append(gotHTTP, route.Host)
+			}
+			sort.Strings(gotHTTP)
+			if !reflect.DeepEqual(gotHTTP, tt.wantHTTP) {
+				t.Errorf("HTTP routes = %v, want %v", gotHTTP, tt.wantHTTP)
+			}
+		})
+	}
+}
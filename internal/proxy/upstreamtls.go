@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	schemeHTTP  = "http"
+	schemeHTTPS = "https"
+)
+
+// upstreamTLSSpec configures how dockname connects to a container serving
+// HTTPS. File paths refer to dockname's own file system, so CA bundles and
+// client certificates have to be mounted into its container.
+type upstreamTLSSpec struct {
+	CA                 string // PEM bundle of the CAs trusted in addition to the system ones
+	Cert               string // PEM client certificate for mutual TLS
+	Key                string // PEM private key of the client certificate
+	ServerName         string // Name sent with SNI and verified, instead of the container IP
+	InsecureSkipVerify bool
+}
+
+// parseScheme validates the scheme of a service, empty meaning plain HTTP.
+func parseScheme(scheme string) (string, error) {
+	switch strings.ToLower(scheme) {
+	case "", schemeHTTP:
+		return schemeHTTP, nil
+	case schemeHTTPS:
+		return schemeHTTPS, nil
+	default:
+		return "", fmt.Errorf("unknown scheme: %s", scheme)
+	}
+}
+
+// upstreamTLSConfig builds the TLS configuration for connections to an HTTPS
+// container. It returns nil when the spec leaves everything at its default.
+func upstreamTLSConfig(spec upstreamTLSSpec) (*tls.Config, error) {
+	if spec == (upstreamTLSSpec{}) {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         spec.ServerName,
+		InsecureSkipVerify: spec.InsecureSkipVerify,
+	}
+
+	if spec.CA != "" {
+		pem, err := os.ReadFile(spec.CA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to parse CA bundle %s: no PEM certificates found", spec.CA)
+		}
+		config.RootCAs = pool
+	}
+
+	if spec.Cert != "" || spec.Key != "" {
+		if spec.Cert == "" || spec.Key == "" {
+			return nil, errors.New("client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(spec.Cert, spec.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
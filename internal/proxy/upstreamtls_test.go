@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/rs/zerolog"
+)
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+// writeClientCert writes a self-signed client certificate and its key to dir.
+func writeClientCert(t *testing.T, dir string) (certPath, keyPath string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certPath = filepath.Join(dir, "client.crt")
+	keyPath = filepath.Join(dir, "client.key")
+	writePEM(t, certPath, "CERTIFICATE", der)
+	writePEM(t, keyPath, "EC PRIVATE KEY", keyDER)
+	return certPath, keyPath
+}
+
+func TestUpstreamTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	backend := httptest.NewTLSServer(http.NotFoundHandler())
+	backend.Close()
+	caPath := filepath.Join(dir, "ca.crt")
+	writePEM(t, caPath, "CERTIFICATE", backend.Certificate().Raw)
+	invalidPath := filepath.Join(dir, "invalid.crt")
+	if err := os.WriteFile(invalidPath, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	certPath, keyPath := writeClientCert(t, dir)
+
+	tests := []struct {
+		name    string
+		spec    upstreamTLSSpec
+		check   func(t *testing.T, config *tls.Config)
+		wantErr bool
+	}{
+		{
+			name: "Success: Defaults need no config",
+			spec: upstreamTLSSpec{},
+			check: func(t *testing.T, config *tls.Config) {
+				if config != nil {
+					t.Errorf("upstreamTLSConfig() = %+v, want nil", config)
+				}
+			},
+		},
+		{
+			name: "Success: Server name and skipped verification",
+			spec: upstreamTLSSpec{ServerName: "keycloak.internal", InsecureSkipVerify: true},
+			check: func(t *testing.T, config *tls.Config) {
+				if config.ServerName != "keycloak.internal" || !config.InsecureSkipVerify {
+					t.Errorf("upstreamTLSConfig() = %+v, want server name and skipped verification", config)
+				}
+			},
+		},
+		{
+			name: "Success: CA bundle and client certificate",
+			spec: upstreamTLSSpec{CA: caPath, Cert: certPath, Key: keyPath},
+			check: func(t *testing.T, config *tls.Config) {
+				if config.RootCAs == nil || len(config.Certificates) != 1 {
+					t.Errorf("upstreamTLSConfig() = %+v, want CA pool and client certificate", config)
+				}
+			},
+		},
+		{
+			name:    "Error: Missing CA bundle",
+			spec:    upstreamTLSSpec{CA: filepath.Join(dir, "missing.crt")},
+			wantErr: true,
+		},
+		{
+			name:    "Error: CA bundle without certificates",
+			spec:    upstreamTLSSpec{CA: invalidPath},
+			wantErr: true,
+		},
+		{
+			name:    "Error: Client certificate without key",
+			spec:    upstreamTLSSpec{Cert: certPath},
+			wantErr: true,
+		},
+		{
+			name:    "Error: Invalid client certificate",
+			spec:    upstreamTLSSpec{Cert: invalidPath, Key: keyPath},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := upstreamTLSConfig(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("upstreamTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, config)
+			}
+		})
+	}
+}
+
+func TestManager_HTTPSUpstream(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	backend.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	backend.StartTLS()
+	defer backend.Close()
+
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse backend URL: %v", err)
+	}
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.crt")
+	writePEM(t, caPath, "CERTIFICATE", backend.Certificate().Raw)
+	certPath, keyPath := writeClientCert(t, dir)
+
+	tests := []struct {
+		name       string
+		labels     map[string]string
+		wantStatus int
+	}{
+		{
+			name: "Success: Mutual TLS with a trusted CA and SNI override",
+			labels: map[string]string{
+				"dockname.scheme":         "https",
+				"dockname.tls.ca":         caPath,
+				"dockname.tls.servername": "example.com",
+				"dockname.tls.cert":       certPath,
+				"dockname.tls.key":        keyPath,
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Success: Skipped verification without client certificate",
+			labels: map[string]string{
+				"dockname.scheme":                 "https",
+				"dockname.tls.insecureskipverify": "true",
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "Error: Untrusted certificate",
+			labels: map[string]string{
+				"dockname.scheme": "https",
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "Error: Server name not in the certificate",
+			labels: map[string]string{
+				"dockname.scheme":         "https",
+				"dockname.tls.ca":         caPath,
+				"dockname.tls.servername": "keycloak.internal",
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.labels["dockname.domain"] = "app.localhost"
+			tt.labels["dockname.port"] = backendURL.Port()
+			containerJSON := testContainerJSON("container1", tt.labels, backendURL.Hostname())
+			mockManager := &mockManager{
+				InspectContainerFn: func(_ context.Context, _ string) (types.ContainerJSON, error) {
+					return containerJSON, nil
+				},
+			}
+			manager := NewManager(mockManager, nil, zerolog.Nop())
+
+			start := events.Message{Type: "container", Action: "start", Actor: events.Actor{ID: "container1"}}
+			if err := manager.eventManager.HandleEvent(context.Background(), start); err != nil {
+				t.Fatalf("HandleEvent(start) error = %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			manager.proxyHandler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://app.localhost/", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("ServeHTTP() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}